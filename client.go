@@ -1,12 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"io"
-	"mime/multipart"
-	"net/http"
 	"os"
-	"path/filepath"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 )
 
 // Interface is FTP client interfaces
@@ -14,87 +14,250 @@ type Interface interface {
 	ReaddirSourceFolder(crontdata Cron) error
 	SetFilenameToDownload(filename []string)
 	GetFilenameToDownload() []string
-	DownloadTempFile(filepath string) error
+	ReadFile(filepath string) (io.ReadCloser, error)
 	Close()
 }
 
+// Archiver is implemented by clients that need to act on a file after it is uploaded,
+// e.g. moving it into an archive folder. archiveFolder is empty when it is not configured
+type Archiver interface {
+	Archive(filepath, archiveFolder string) error
+}
+
+// Stater is implemented by clients that can return the size and modified time of a file
+type Stater interface {
+	Stat(filepath string) (os.FileInfo, error)
+}
+
+// fileInfo is used by clients which do not get an os.FileInfo from their library
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (f *fileInfo) Name() string       { return f.name }
+func (f *fileInfo) Size() int64        { return f.size }
+func (f *fileInfo) Mode() os.FileMode  { return 0644 }
+func (f *fileInfo) ModTime() time.Time { return f.modTime }
+func (f *fileInfo) IsDir() bool        { return false }
+func (f *fileInfo) Sys() interface{}   { return nil }
+
 // InitiateFTPClient will initiates ftp client based on client type, whether it is a FTP/s or SFTP
-// By default it will use SFTP
-func InitiateFTPClient(clientType string, config *Config) Interface {
-	host := config.Source.Host
-	port := config.Source.Port
-	username := config.Source.Username
-	password := config.Source.Password
-	dirpath := config.Source.Folder
+// By default it will use SFTP. The source folder of the job is read once connected. When source.hosts
+// is set the hosts are tried in order, starting from the host which served the previous run, a host
+// which cannot be connected or listed is failed over, e.g. http and webdav only fail when listing
+func InitiateFTPClient(clientType string, source Source, crondata Cron) (Interface, error) {
+	hosts := source.Hosts
+	if len(hosts) == 0 {
+		hosts = []SourceHost{{Host: source.Host, Port: source.Port}}
+	}
+
+	timeout := time.Duration(source.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultSourceTimeout
+	}
+
+	key := clientType + "/" + hosts[0].Host
+	first := LastSourceHost[key] % len(hosts)
+
+	var errClient error
+	for i := range hosts {
+		index := (first + i) % len(hosts)
+		host := hosts[index]
+
+		var clientSession Interface
+		clientSession, errClient = newSourceClient(clientType, source, host.Host, host.Port, timeout)
+		if errClient != nil {
+			Logf("Failed to connect source host=%s port=%s error=%s\n", host.Host, host.Port, errClient.Error())
+			continue
+		}
+
+		errClient = clientSession.ReaddirSourceFolder(crondata)
+		if errClient != nil {
+			Logf("Failed to list directory dir=%s host=%s port=%s error=%s\n", crondata.Task.SourceFolder, host.Host, host.Port, errClient.Error())
+			clientSession.Close()
+			continue
+		}
+
+		if len(hosts) > 1 {
+			Logf("Source host=%s port=%s is connected\n", host.Host, host.Port)
+		}
+		LastSourceHost[key] = index
+		return clientSession, nil
+	}
+
+	return nil, errClient
+}
+
+func newSourceClient(clientType string, source Source, host, port string, timeout time.Duration) (Interface, error) {
+	username := source.Username
+	password := source.Password
+	dirpath := source.Folder
 
 	var clientSession Interface
+	var errClient error
 
 	switch clientType {
 	case `sftp`:
-		clientSession = NewSFTP(host, port, username, password)
+		clientSession, errClient = NewSFTP(host, port, username, password, timeout)
 		break
 	case `ftps`:
-		clientSession = NewFTPS(host, port, username, password)
+		clientSession, errClient = NewFTPS(host, port, username, password, timeout)
 		break
 	case `local`:
 		clientSession = NewLocalFolder(dirpath)
 		break
+	case `http`, `https`:
+		clientSession = NewHTTP(host, username, password, source.Header, source.Listing, timeout)
+		break
+	case `webdav`:
+		clientSession = NewWebDAV(host, username, password, timeout)
+		break
+	case `smb`:
+		clientSession, errClient = NewSMB(host, port, username, password, source.Domain, source.Share, timeout)
+		break
+	case `imap`:
+		clientSession, errClient = NewIMAP(host, port, username, password, timeout)
+		break
+	case `s3`:
+		clientSession, errClient = NewS3(host, port, username, password, source.Bucket, source.Region, source.SSL, timeout)
+		break
 	default:
-		clientSession = NewSFTP(host, port, username, password)
+		clientSession, errClient = NewSFTP(host, port, username, password, timeout)
 	}
 
-	return clientSession
+	return clientSession, errClient
 }
 
-// Upload is used to uplad download temp file to destination
-func Upload(config *Config, tempfilepath string) error {
-	Logf("Uploading file=%s ...\n", tempfilepath)
+// isFileToDownload checks whether a file in source folder matches the file prefix rules
+// of a cron task, it must be modified today in the job time zone and newer than the last uploaded file
+// with the same prefix code. The file is only marked as uploaded by markFileProcessed
+func isFileToDownload(crondata Cron, filename string, modTime time.Time) bool {
+	return isListedFileToDownload(crondata, filename, filename, modTime)
+}
+
+// isListedFileToDownload is isFileToDownload for sources which list a file under another name
+// than its filename, e.g. a full path or `<uid>/<part>/<filename>` for imap attachments
+func isListedFileToDownload(crondata Cron, listedName, filename string, modTime time.Time) bool {
+	isMatch, _ := regexp.MatchString(crondata.Task.FilePrefix, filename)
+	location := jobLocation(crondata)
+	now := time.Now().In(location)
+	isYearMatch := modTime.In(location).Year() == now.Year()
+	isMonthMatch := modTime.In(location).Month() == now.Month()
+	isDayMatch := modTime.In(location).Day() == now.Day()
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	prefixCode, ok := filePrefixCode(crondata, filename)
+	if !ok {
+		return false
+	}
 
-	for _, uploadItem := range config.Target.Upload {
-		if uploadItem["key"] == uploadItem["value"] {
-			file, err := os.Open(tempfilepath)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	// The last uploaded file is kept per job, jobs may share prefix codes such as a date
+	prefixKey := fileKey(crondata, prefixCode)
+	isFileLatestUpdate := modTime.After(LastFileModTime[prefixKey])
+	isPrevFileDifferent := LastFileUpload[prefixKey] != filename
 
-			part, err := writer.CreateFormFile(uploadItem["key"], filepath.Base(tempfilepath))
-			if err != nil {
-				return err
-			}
-			_, _ = io.Copy(part, file)
-		} else {
-			writer.WriteField(uploadItem["key"], uploadItem["value"])
-		}
+	if isMatch && isYearMatch && isMonthMatch && isDayMatch && isFileLatestUpdate && isPrevFileDifferent {
+		selectFile(crondata, listedName, modTime)
+		return true
+	}
+
+	return false
+}
+
+// isAttachmentToDownload checks whether an attachment of an unseen message matches the file prefix
+// of a cron task. A message is marked as seen once its attachments are uploaded, so the attachment
+// is not compared with the last uploaded file which may have the same name
+func isAttachmentToDownload(crondata Cron, listedName, filename string, modTime time.Time) bool {
+	isMatch, _ := regexp.MatchString(crondata.Task.FilePrefix, filename)
+	if !isMatch {
+		return false
+	}
+
+	selectFile(crondata, listedName, modTime)
+	return true
+}
+
+// selectFile remembers the modified time of a selected file until it is processed
+func selectFile(crondata Cron, listedName string, modTime time.Time) {
+	// A modified file is delivered again to every target
+	key := fileKey(crondata, listedName)
+	if !PendingFileModTime[key].Equal(modTime) {
+		delete(DeliveredFileTarget, key)
+		delete(FailedFileTarget, key)
+	}
+	PendingFileModTime[key] = modTime
+}
+
+// markFileProcessed marks a selected file as the last uploaded file of its prefix code in the job,
+// listedName is the name returned by the source listing
+func markFileProcessed(crondata Cron, listedName string) {
+	key := fileKey(crondata, listedName)
+	delete(DeliveredFileTarget, key)
+	delete(FailedFileTarget, key)
+
+	modTime, ok := PendingFileModTime[key]
+	if !ok {
+		return
 	}
+	delete(PendingFileModTime, key)
 
-	errWriterClose := writer.Close()
-	if errWriterClose != nil {
-		return errWriterClose
+	filename := path.Base(listedName)
+	prefixCode, ok := filePrefixCode(crondata, filename)
+	prefixKey := fileKey(crondata, prefixCode)
+	if ok && modTime.After(LastFileModTime[prefixKey]) {
+		LastFileModTime[prefixKey] = modTime
+		LastFileUpload[prefixKey] = filename
 	}
+}
 
-	req, err := http.NewRequest("POST", config.Target.Host, body)
-	if err != nil {
-		return err
+// isFileDelivered checks whether a file which is not processed yet was delivered to a target
+func isFileDelivered(crondata Cron, listedName, target string) bool {
+	return DeliveredFileTarget[fileKey(crondata, listedName)][target]
+}
+
+// markFileDelivered remembers a target received a file until the file is processed
+func markFileDelivered(crondata Cron, listedName, target string) {
+	key := fileKey(crondata, listedName)
+	if DeliveredFileTarget[key] == nil {
+		DeliveredFileTarget[key] = make(map[string]bool)
 	}
+	DeliveredFileTarget[key][target] = true
+}
 
-	for _, header := range config.Target.Header {
-		req.Header.Set(header["key"], header["value"])
+// isFileFailed checks whether a file failed permanently on a target and is not modified since
+func isFileFailed(crondata Cron, listedName, target string) bool {
+	key := fileKey(crondata, listedName)
+	modTime, ok := FailedFileTarget[key][target]
+
+	return ok && modTime.Equal(PendingFileModTime[key])
+}
+
+// markFileFailed remembers a target failed permanently on a selected file, files which
+// are not selected by their modified time are tried again every run
+func markFileFailed(crondata Cron, listedName, target string) {
+	key := fileKey(crondata, listedName)
+	modTime, ok := PendingFileModTime[key]
+	if !ok {
+		return
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	httpclient := &http.Client{}
-	resp, err := httpclient.Do(req)
-	if err != nil {
-		return err
+	if FailedFileTarget[key] == nil {
+		FailedFileTarget[key] = make(map[string]time.Time)
 	}
+	FailedFileTarget[key][target] = modTime
+}
 
-	if resp.StatusCode != 200 {
-		return Upload(config, tempfilepath)
+func filePrefixCode(crondata Cron, filename string) (string, bool) {
+	prefixCodes := strings.Split(filename, crondata.Task.FilePrefixDelimiter)
+	if int(crondata.Task.FilePrefixIndex) >= len(prefixCodes) {
+		return "", false
 	}
 
-	return nil
+	return prefixCodes[crondata.Task.FilePrefixIndex], true
+}
+
+// fileKey identifies a listed file of a job
+func fileKey(crondata Cron, listedName string) string {
+	return crondata.Name + "/" + listedName
 }
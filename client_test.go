@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkFileProcessedPerJob(t *testing.T) {
+	task := CronTask{FilePrefix: `\d+.csv$`, FilePrefixDelimiter: "_", FilePrefixIndex: 1}
+	cimb := Cron{Name: "statement-CIMB", Task: task}
+	bca := Cron{Name: "statement-BCA", Task: task}
+	modTime := time.Now()
+	for _, crondata := range []Cron{cimb, bca} {
+		delete(LastFileModTime, fileKey(crondata, "20261019.csv"))
+		delete(LastFileUpload, fileKey(crondata, "20261019.csv"))
+	}
+
+	// Both files have the prefix code 20261019.csv, each job keeps its own last uploaded file
+	assert.True(t, isFileToDownload(cimb, "CIMB_20261019.csv", modTime))
+	markFileProcessed(cimb, "CIMB_20261019.csv")
+	assert.False(t, isFileToDownload(cimb, "CIMB_20261019.csv", modTime))
+
+	assert.True(t, isFileToDownload(bca, "BCA_20261019.csv", modTime))
+	markFileProcessed(bca, "BCA_20261019.csv")
+	assert.False(t, isFileToDownload(bca, "BCA_20261019.csv", modTime))
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -29,6 +30,18 @@ func NewConfig(configFile string, configType string) *Config {
 		InitiateYaml(&config, configFile)
 	}
 
+	config.ExpandJobs()
+
+	errTimezones := config.LoadTimezones()
+	if errTimezones != nil {
+		log.Fatal(errTimezones)
+	}
+
+	errConnections := config.ResolveConnections()
+	if errConnections != nil {
+		log.Fatal(errConnections)
+	}
+
 	return &config
 }
 
@@ -36,12 +49,12 @@ func NewConfig(configFile string, configType string) *Config {
 func InitiateYaml(config *Config, filepath string) {
 	configdata, errReadFile := ioutil.ReadFile(filepath)
 	if errReadFile != nil {
-		log.Fatalf(errReadFile.Error())
+		log.Fatal(errReadFile)
 	}
 
 	errParseYaml := yaml.Unmarshal(configdata, &config)
 	if errParseYaml != nil {
-		log.Fatalf(errParseYaml.Error())
+		log.Fatal(errParseYaml)
 	}
 }
 
@@ -50,12 +63,12 @@ func InitiateYamlBase64(config *Config, envkey string) {
 	tempConfigDataInBase64 := os.Getenv(envkey)
 	configdata, err := base64.StdEncoding.DecodeString(tempConfigDataInBase64)
 	if err != nil {
-		log.Fatalf(err.Error())
+		log.Fatal(err)
 	}
 
 	errParseYaml := yaml.Unmarshal([]byte(configdata), &config)
 	if errParseYaml != nil {
-		log.Fatalf(errParseYaml.Error())
+		log.Fatal(errParseYaml)
 	}
 }
 
@@ -68,9 +81,17 @@ func InitiateFromEnv(config *Config) {
 	config.Source.Username = os.Getenv("SOURCE_USERNAME")
 	config.Source.Password = os.Getenv("SOURCE_PASSWORD")
 	config.Source.Folder = os.Getenv("SOURCE_FOLDER")
+	config.Source.Bucket = os.Getenv("SOURCE_BUCKET")
+	config.Source.Region = os.Getenv("SOURCE_REGION")
+	config.Source.SSL = os.Getenv("SOURCE_SSL") == "true"
+	config.Source.Domain = os.Getenv("SOURCE_DOMAIN")
+	config.Source.Share = os.Getenv("SOURCE_SHARE")
 
 	config.Target.Type = os.Getenv("TARGET_TYPE")
 	config.Target.Host = os.Getenv("TARGET_HOST")
+	config.Target.Username = os.Getenv("TARGET_USERNAME")
+	config.Target.Password = os.Getenv("TARGET_PASSWORD")
+	config.Target.Folder = os.Getenv("TARGET_FOLDER")
 
 	targetHeader := os.Getenv("TARGET_HEADER")
 	targetHeaders := strings.Split(targetHeader, `;`)
@@ -131,46 +152,270 @@ func InitiateFromEnv(config *Config) {
 			FilePrefix:          os.Getenv("TASK_FILE_PREFIX"),
 			FilePrefixDelimiter: os.Getenv("TASK_FILE_PREFIX_DELIMITER"),
 			FilePrefixIndex:     filePrefixIndex,
+			ArchiveFolder:       os.Getenv("TASK_ARCHIVE_FOLDER"),
+			Sender:              os.Getenv("TASK_SENDER"),
+			Subject:             os.Getenv("TASK_SUBJECT"),
 		},
 	}
 
 	config.Cron = append(config.Cron, cron)
+	config.Quarantine.Folder = os.Getenv("QUARANTINE_FOLDER")
+	config.Timezone = os.Getenv("TIMEZONE")
 }
 
 // Config represents the config file for go-upload
 type Config struct {
-	Source Source `yaml:"source" json:"source"`
-	Target Target `yaml:"target" json:"target"`
-	Cron   []Cron `yaml:"cron" json:"cron"`
+	Source      Source      `yaml:"source" json:"source"`
+	Target      Target      `yaml:"target" json:"target"`
+	Targets     []Target    `yaml:"targets" json:"targets"`
+	Connections Connections `yaml:"connections" json:"connections"`
+	Defaults    Cron        `yaml:"defaults" json:"defaults"`
+	Timezone    string      `yaml:"timezone" json:"timezone"`
+	Cron        []Cron      `yaml:"cron" json:"cron"`
+	Quarantine  Quarantine  `yaml:"quarantine" json:"quarantine"`
+}
+
+// Connections contains the named sources and targets which are referenced by connection
+type Connections struct {
+	Sources map[string]Source `yaml:"sources" json:"sources"`
+	Targets map[string]Target `yaml:"targets" json:"targets"`
+}
+
+// JobSource returns the source of a job: its own source, otherwise the source
+func (c *Config) JobSource(crondata Cron) Source {
+	if !reflect.ValueOf(crondata.Source).IsZero() {
+		return crondata.Source
+	}
+
+	return c.Source
+}
+
+// JobTargets returns the targets of a job: its own targets, otherwise targets,
+// otherwise the single target
+func (c *Config) JobTargets(crondata Cron) []Target {
+	if len(crondata.Targets) > 0 {
+		return crondata.Targets
+	}
+
+	if len(c.Targets) > 0 {
+		return c.Targets
+	}
+
+	return []Target{c.Target}
 }
 
 // Source represents parameter used for get data from source data
 type Source struct {
-	Type     string `yaml:"type"`
-	Host     string `yaml:"host"`
-	Port     string `yaml:"port"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	Folder   string `yaml:"folder"`
+	Connection string              `yaml:"connection"`
+	Type       string              `yaml:"type"`
+	Host       string              `yaml:"host"`
+	Port       string              `yaml:"port"`
+	Username   string              `yaml:"username"`
+	Password   string              `yaml:"password"`
+	Folder     string              `yaml:"folder"`
+	Bucket     string              `yaml:"bucket"`
+	Region     string              `yaml:"region"`
+	SSL        bool                `yaml:"ssl"`
+	Domain     string              `yaml:"domain"`
+	Share      string              `yaml:"share"`
+	Header     []map[string]string `yaml:"header"`
+	Listing    SourceListing       `yaml:"listing"`
+	Hosts      []SourceHost        `yaml:"hosts"`
+	Timeout    int64               `yaml:"timeout"`
+	Fields     FieldSet            `yaml:"-"`
+}
+
+// SourceHost represents a source host, hosts are tried in order when the previous one is unreachable
+type SourceHost struct {
+	Host string `yaml:"host"`
+	Port string `yaml:"port"`
+}
+
+// SourceListing represents how the http source reads its file listing
+// Paths are json paths, items is evaluated against the response and the others against each item
+type SourceListing struct {
+	Format         string `yaml:"format"`
+	Items          string `yaml:"items"`
+	Name           string `yaml:"name"`
+	URL            string `yaml:"url"`
+	Size           string `yaml:"size"`
+	Modified       string `yaml:"modified"`
+	ModifiedLayout string `yaml:"modified_layout"`
+	Next           string `yaml:"next"`
 }
 
 // Target represents parameter used for submit data to target data
 type Target struct {
-	Type    string              `yaml:"type"`
-	Host    string              `yaml:"host"`
-	Header  []map[string]string `yaml:"header"`
-	Upload  []map[string]string `yaml:"upload"`
-	Timeout int64               `yaml:"timeout"`
+	Connection  string              `yaml:"connection"`
+	Name        string              `yaml:"name"`
+	Optional    bool                `yaml:"optional"`
+	Type        string              `yaml:"type"`
+	Host        string              `yaml:"host"`
+	Endpoints   []Endpoint          `yaml:"endpoints"`
+	Strategy    string              `yaml:"strategy"`
+	Cooldown    int64               `yaml:"cooldown"`
+	Username    string              `yaml:"username"`
+	Password    string              `yaml:"password"`
+	Folder      string              `yaml:"folder"`
+	Filename    string              `yaml:"filename"`
+	Method      string              `yaml:"method"`
+	Mode        string              `yaml:"mode"`
+	ContentType string              `yaml:"content_type"`
+	Header      []map[string]string `yaml:"header"`
+	Query       []map[string]string `yaml:"query"`
+	Upload      []map[string]string `yaml:"upload"`
+	Timeout     int64               `yaml:"timeout"`
+	TLS         TargetTLS           `yaml:"tls"`
+	Proxy       Proxy               `yaml:"proxy"`
+	OAuth2      OAuth2              `yaml:"oauth2"`
+	Tus         Tus                 `yaml:"tus"`
+	Steps       []Step              `yaml:"steps"`
+	Poll        Poll                `yaml:"poll"`
+	Signing     Signing             `yaml:"signing"`
+	Retry       Retry               `yaml:"retry"`
+	Success     Success             `yaml:"success"`
+	Fields      FieldSet            `yaml:"-"`
+}
+
+// TargetTLS represents the CA bundle and client certificate used to connect to the target,
+// files are PEM encoded and MinVersion is one of 1.0, 1.1, 1.2, 1.3
+type TargetTLS struct {
+	CA                 string `yaml:"ca"`
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	MinVersion         string `yaml:"min_version"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// Proxy represents the proxy used to connect to the target, URL is a http, https or socks5 url
+// NoProxy is a list of hosts, domains or CIDR that are connected directly
+type Proxy struct {
+	URL      string   `yaml:"url"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	NoProxy  []string `yaml:"no_proxy"`
+}
+
+// Step represents a request of a multi-step upload, URL, Header and Body are templates
+// which can use values extracted from previous steps. Mode is empty for a request
+// without the file, or raw, multipart, form-urlencoded-base64 to send the file
+// Extract items have a key and either a json path or a header name
+type Step struct {
+	Name        string              `yaml:"name"`
+	Method      string              `yaml:"method"`
+	URL         string              `yaml:"url"`
+	Mode        string              `yaml:"mode"`
+	ContentType string              `yaml:"content_type"`
+	Header      []map[string]string `yaml:"header"`
+	Body        string              `yaml:"body"`
+	Extract     []map[string]string `yaml:"extract"`
+	Success     Success             `yaml:"success"`
+}
+
+// Poll represents the processing status polled after an upload, the status url is taken from
+// a response header or a json path of the response body. Status is a json path on the status
+// response, and Success and Failure are its terminal values. Interval and Timeout are in seconds
+type Poll struct {
+	Header   string   `yaml:"header"`
+	JSON     string   `yaml:"json"`
+	Status   string   `yaml:"status"`
+	Success  []string `yaml:"success"`
+	Failure  []string `yaml:"failure"`
+	Interval int64    `yaml:"interval"`
+	Timeout  int64    `yaml:"timeout"`
+}
+
+// Tus represents the tus target, ChunkSize is in bytes and StateFile keeps
+// the upload url of unfinished uploads
+type Tus struct {
+	ChunkSize int64  `yaml:"chunk_size"`
+	StateFile string `yaml:"state_file"`
+}
+
+// OAuth2 represents the client credentials used to get a bearer token for the target
+// AuthStyle is header (basic auth, default) or params (client id and secret in the form)
+type OAuth2 struct {
+	TokenURL     string   `yaml:"token_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	AuthStyle    string   `yaml:"auth_style"`
+}
+
+// Signing represents the HMAC signature of upload requests, Canonical and Header values
+// are templates with the request method, path, timestamp, body digest and signature
+type Signing struct {
+	Key       string              `yaml:"key"`
+	Algorithm string              `yaml:"algorithm"`
+	Encoding  string              `yaml:"encoding"`
+	Canonical string              `yaml:"canonical"`
+	Header    []map[string]string `yaml:"header"`
+}
+
+// Endpoint represents one of the hosts of a target, Weight is used by the weighted strategy
+type Endpoint struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+// Success represents when an upload to http target is successful
+// Status defaults to any 2xx, Accept codes are successful without checking the body
+// and Body is a json condition on the response, e.g. `$.status == "OK"`
+type Success struct {
+	Status []int  `yaml:"status"`
+	Accept []int  `yaml:"accept"`
+	Body   string `yaml:"body"`
+}
+
+// Retry represents the retry policy of a target, intervals are in seconds
+// Jitter is nil when it is not set, so `jitter: 0` disables the jitter
+// Errors is a list of error classes: timeout, connection, dns, tls, other
+type Retry struct {
+	MaxAttempts     int      `yaml:"max_attempts"`
+	InitialInterval int64    `yaml:"initial_interval"`
+	MaxInterval     int64    `yaml:"max_interval"`
+	Jitter          *float64 `yaml:"jitter"`
+	Status          []int    `yaml:"status"`
+	Errors          []string `yaml:"errors"`
+}
+
+// Quarantine represents where files that failed permanently are kept
+type Quarantine struct {
+	Folder string `yaml:"folder"`
 }
 
 // Cron represents parameter used for schedule task
 type Cron struct {
-	Name        string   `yaml:"name"`
-	Type        string   `yaml:"type"`
-	SpecificDay string   `yaml:"specific_day"`
-	At          string   `yaml:"at"`
-	Every       uint64   `yaml:"every"`
-	Task        CronTask `yaml:"task"`
+	Name        string              `yaml:"name"`
+	Type        string              `yaml:"type"`
+	SpecificDay string              `yaml:"specific_day"`
+	At          string              `yaml:"at"`
+	Schedule    string              `yaml:"schedule"`
+	Timezone    string              `yaml:"timezone"`
+	Every       uint64              `yaml:"every"`
+	Source      Source              `yaml:"source"`
+	Task        CronTask            `yaml:"task"`
+	Targets     []Target            `yaml:"targets"`
+	Routes      []Route             `yaml:"routes"`
+	Matrix      []map[string]string `yaml:"matrix"`
+	Vars        map[string]string   `yaml:"-"`
+	Fields      FieldSet            `yaml:"-"`
+}
+
+// Route represents a routing rule of a job, a file is sent to target or dropped
+// when it matches every condition which is set
+type Route struct {
+	Match   string `yaml:"match"`
+	Group   string `yaml:"group"`
+	Value   string `yaml:"value"`
+	MinSize int64  `yaml:"min_size"`
+	MaxSize int64  `yaml:"max_size"`
+	Content string `yaml:"content"`
+	Header  string `yaml:"header"`
+	Bytes   int64  `yaml:"bytes"`
+	Target  string `yaml:"target"`
+	Drop    bool   `yaml:"drop"`
 }
 
 // CronTask specifies source folder and the file that want to be uploaded
@@ -180,4 +425,7 @@ type CronTask struct {
 	FilePrefix          string `yaml:"file_prefix"`
 	FilePrefixDelimiter string `yaml:"file_prefix_delimiter"`
 	FilePrefixIndex     int64  `yaml:"file_prefix_index"`
+	ArchiveFolder       string `yaml:"archive_folder"`
+	Sender              string `yaml:"sender"`
+	Subject             string `yaml:"subject"`
 }
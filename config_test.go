@@ -1,7 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -35,3 +37,128 @@ func TestNewConfigWithEnvVariables(t *testing.T) {
 	assert.Equal(t, "http", config.Target.Type)
 	assert.Equal(t, "get-sample-txt", config.Cron[0].Name)
 }
+
+func TestResolveConnections(t *testing.T) {
+	config := &Config{
+		Connections: Connections{
+			Sources: map[string]Source{
+				"bank-a": {Type: "sftp", Host: "sftp.bank-a.com", Port: "22", Folder: "/out"},
+			},
+			Targets: map[string]Target{
+				"recon": {Host: "https://recon.example.com/upload", Timeout: 30},
+			},
+		},
+		Cron: []Cron{
+			{
+				Name:    "bank-a",
+				Source:  Source{Connection: "bank-a", Folder: "/statements"},
+				Targets: []Target{{Connection: "recon", Timeout: 60}},
+			},
+			{Name: "default"},
+		},
+	}
+
+	assert.Nil(t, config.ResolveConnections())
+
+	source := config.JobSource(config.Cron[0])
+	assert.Equal(t, "sftp.bank-a.com", source.Host)
+	assert.Equal(t, "/statements", source.Folder)
+
+	target := config.JobTargets(config.Cron[0])[0]
+	assert.Equal(t, "recon", target.Name)
+	assert.Equal(t, "https://recon.example.com/upload", target.Host)
+	assert.Equal(t, int64(60), target.Timeout)
+
+	config.Source = Source{Type: "local"}
+	assert.Equal(t, "local", config.JobSource(config.Cron[1]).Type)
+
+	config.Cron[1].Source.Connection = "missing"
+	assert.NotNil(t, config.ResolveConnections())
+}
+
+func TestResolveConnectionsYAML(t *testing.T) {
+	folder, err := ioutil.TempDir("", "kintoun-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(folder)
+
+	configFile := filepath.Join(folder, "config.yaml")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte(`
+source:
+  type: sftp
+  host: sftp.example.com
+  hosts:
+    - host: sftp-primary.example.com
+    - host: sftp-secondary.example.com
+  username: foo
+  timeout: 10
+connections:
+  sources:
+    storage:
+      type: s3
+      host: s3.example.com
+      ssl: true
+  targets:
+    recon:
+      host: https://recon.example.com/upload
+      optional: true
+      tls:
+        ca: /etc/kintoun/ca.pem
+        insecure_skip_verify: true
+defaults:
+  task:
+    file_prefix: .csv$
+    file_prefix_index: 1
+cron:
+  - name: storage
+    source:
+      connection: storage
+      ssl: false
+    targets:
+      - connection: recon
+        optional: false
+        tls:
+          insecure_skip_verify: false
+          min_version: "1.2"
+    task:
+      file_prefix_index: 0
+  - name: sftp
+    source:
+      folder: /out
+  - name: partner
+    source:
+      host: sftp.partner.com
+      port: "2222"
+`), 0644))
+
+	config := NewConfig(configFile, "yaml")
+
+	// Fields which are set to false or 0 override the connection and the defaults
+	storage := config.Cron[0]
+	assert.Equal(t, "s3.example.com", config.JobSource(storage).Host)
+	assert.False(t, config.JobSource(storage).SSL)
+	assert.Equal(t, int64(0), storage.Task.FilePrefixIndex)
+	assert.Equal(t, ".csv$", storage.Task.FilePrefix)
+
+	// Nested settings are merged field by field
+	target := config.JobTargets(storage)[0]
+	assert.False(t, target.Optional)
+	assert.False(t, target.TLS.InsecureSkipVerify)
+	assert.Equal(t, "/etc/kintoun/ca.pem", target.TLS.CA)
+	assert.Equal(t, "1.2", target.TLS.MinVersion)
+
+	// A job source without connection is merged into the top level source
+	sftp := config.Cron[1]
+	assert.Equal(t, int64(1), sftp.Task.FilePrefixIndex)
+	assert.Equal(t, "sftp.example.com", config.JobSource(sftp).Host)
+	assert.Equal(t, "foo", config.JobSource(sftp).Username)
+	assert.Equal(t, "/out", config.JobSource(sftp).Folder)
+	assert.Equal(t, int64(10), config.JobSource(sftp).Timeout)
+	assert.Len(t, config.JobSource(sftp).Hosts, 2)
+
+	// A job which sets its own host does not inherit the hosts of the top level source
+	partner := config.JobSource(config.Cron[2])
+	assert.Equal(t, "sftp.partner.com", partner.Host)
+	assert.Equal(t, "2222", partner.Port)
+	assert.Equal(t, "foo", partner.Username)
+	assert.Empty(t, partner.Hosts)
+}
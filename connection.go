@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ResolveConnections replaces every source and target which references a connection by
+// the named connection, fields which are set next to the reference override the connection
+func (c *Config) ResolveConnections() error {
+	var errResolve error
+
+	c.Source, errResolve = c.resolveSource(c.Source)
+	if errResolve != nil {
+		return errResolve
+	}
+
+	c.Target, errResolve = c.resolveTarget(c.Target)
+	if errResolve != nil {
+		return errResolve
+	}
+
+	for index := range c.Targets {
+		c.Targets[index], errResolve = c.resolveTarget(c.Targets[index])
+		if errResolve != nil {
+			return errResolve
+		}
+	}
+
+	for index := range c.Cron {
+		crondata := &c.Cron[index]
+
+		crondata.Source, errResolve = c.resolveSource(crondata.Source)
+		if errResolve != nil {
+			return fmt.Errorf("job=%s %s", crondata.Name, errResolve.Error())
+		}
+
+		// A job source without connection is merged into the top level source
+		if crondata.Source.Connection == "" && !reflect.ValueOf(crondata.Source).IsZero() {
+			source := c.Source
+			overrideSource(&source, crondata.Source)
+			crondata.Source = source
+		}
+
+		for targetIndex := range crondata.Targets {
+			crondata.Targets[targetIndex], errResolve = c.resolveTarget(crondata.Targets[targetIndex])
+			if errResolve != nil {
+				return fmt.Errorf("job=%s %s", crondata.Name, errResolve.Error())
+			}
+		}
+
+		// Matrix variables are replaced in the options taken from connections as well
+		if len(crondata.Vars) > 0 {
+			crondata.Source = copyValue(reflect.ValueOf(crondata.Source), crondata.Vars).Interface().(Source)
+			crondata.Targets = copyValue(reflect.ValueOf(crondata.Targets), crondata.Vars).Interface().([]Target)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) resolveSource(source Source) (Source, error) {
+	if source.Connection == "" {
+		return source, nil
+	}
+
+	connection, ok := c.Connections.Sources[source.Connection]
+	if !ok {
+		return source, fmt.Errorf("source connection=%s is not found", source.Connection)
+	}
+
+	overrideSource(&connection, source)
+	return connection, nil
+}
+
+func (c *Config) resolveTarget(target Target) (Target, error) {
+	if target.Connection == "" {
+		return target, nil
+	}
+
+	connection, ok := c.Connections.Targets[target.Connection]
+	if !ok {
+		return target, fmt.Errorf("target connection=%s is not found", target.Connection)
+	}
+
+	overrideFields(&connection, &target)
+	if connection.Name == "" {
+		connection.Name = target.Connection
+	}
+
+	return connection, nil
+}
+
+// overrideSource overrides base by the fields of override which are set, hosts of base
+// are not used when override sets its own host or port
+func overrideSource(base *Source, override Source) {
+	overrideFields(base, &override)
+
+	isHostSet := override.Host != "" || override.Port != ""
+	isHostsSet := len(override.Hosts) > 0
+	if override.Fields != nil {
+		isHostSet = override.Fields["host"] || override.Fields["port"]
+		isHostsSet = override.Fields["hosts"]
+	}
+
+	if isHostSet && !isHostsSet {
+		base.Hosts = nil
+	}
+}
+
+// overrideFields copies every field of override which is set into base. A field read from
+// the config file is set when its key is present, so false or 0 overrides base as well,
+// otherwise it is set when it is not empty. Nested settings such as tls or oauth2
+// are merged field by field and lists are replaced as a whole
+func overrideFields(base, override interface{}) {
+	overrideValue := reflect.ValueOf(override).Elem()
+
+	var fields FieldSet
+	if value := overrideValue.FieldByName("Fields"); value.IsValid() {
+		fields, _ = value.Interface().(FieldSet)
+	}
+
+	overrideStruct(reflect.ValueOf(base).Elem(), overrideValue, fields, "")
+}
+
+func overrideStruct(base, override reflect.Value, fields FieldSet, prefix string) {
+	for index := 0; index < base.NumField(); index++ {
+		field := override.Field(index)
+		key := prefix + yamlKey(override.Type().Field(index))
+
+		if fieldSet, ok := field.Interface().(FieldSet); ok {
+			baseFieldSet, _ := base.Field(index).Interface().(FieldSet)
+			base.Field(index).Set(reflect.ValueOf(baseFieldSet.Union(fieldSet)))
+			continue
+		}
+
+		if field.Kind() == reflect.Struct {
+			overrideStruct(base.Field(index), field, fields, key+".")
+			continue
+		}
+
+		isSet := !field.IsZero()
+		if fields != nil {
+			isSet = fields[key]
+		}
+
+		if isSet {
+			base.Field(index).Set(field)
+		}
+	}
+}
+
+func yamlKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if key == "" {
+		return strings.ToLower(field.Name)
+	}
+
+	return key
+}
+
+// FieldSet keeps the yaml paths of the fields which are present in the config file,
+// e.g. `tls.insecure_skip_verify`, it is nil when the config is not read from yaml
+type FieldSet map[string]bool
+
+// Union returns the fields which are present in either field set
+func (f FieldSet) Union(other FieldSet) FieldSet {
+	if f == nil && other == nil {
+		return nil
+	}
+
+	union := make(FieldSet, len(f)+len(other))
+	for key := range f {
+		union[key] = true
+	}
+	for key := range other {
+		union[key] = true
+	}
+
+	return union
+}
+
+func newFieldSet(unmarshal func(interface{}) error) (FieldSet, error) {
+	var raw map[interface{}]interface{}
+	err := unmarshal(&raw)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(FieldSet)
+	fields.add("", raw)
+
+	return fields, nil
+}
+
+func (f FieldSet) add(prefix string, raw map[interface{}]interface{}) {
+	for key, value := range raw {
+		path := prefix + fmt.Sprint(key)
+		f[path] = true
+
+		if nested, ok := value.(map[interface{}]interface{}); ok {
+			f.add(path+".", nested)
+		}
+	}
+}
+
+// UnmarshalYAML reads a source and the fields which are present
+func (s *Source) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Source
+	err := unmarshal((*plain)(s))
+	if err != nil {
+		return err
+	}
+
+	s.Fields, err = newFieldSet(unmarshal)
+	return err
+}
+
+// UnmarshalYAML reads a target and the fields which are present
+func (t *Target) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Target
+	err := unmarshal((*plain)(t))
+	if err != nil {
+		return err
+	}
+
+	t.Fields, err = newFieldSet(unmarshal)
+	return err
+}
+
+// UnmarshalYAML reads a job and the fields which are present
+func (c *Cron) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Cron
+	err := unmarshal((*plain)(c))
+	if err != nil {
+		return err
+	}
+
+	c.Fields, err = newFieldSet(unmarshal)
+	return err
+}
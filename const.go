@@ -2,5 +2,29 @@ package main
 
 import "time"
 
+// MaxResponseBodySize is the maximum size of target response body that is read
+const MaxResponseBodySize = 1 << 20
+
+// DefaultSourceTimeout is used to connect a source host when source.timeout is not set
+const DefaultSourceTimeout = 30 * time.Second
+
 var LastFileModTime map[string]time.Time = make(map[string]time.Time)
 var LastFileUpload map[string]string = make(map[string]string)
+var LastFileETag map[string]string = make(map[string]string)
+var LastFileModified map[string]string = make(map[string]string)
+
+// PendingFileModTime keeps the modified time of selected files until they are processed
+var PendingFileModTime map[string]time.Time = make(map[string]time.Time)
+
+// DeliveredFileTarget keeps the targets that received a file which is not processed yet
+var DeliveredFileTarget map[string]map[string]bool = make(map[string]map[string]bool)
+
+// FailedFileTarget keeps the modified time of a file when it failed permanently on a target,
+// the target is skipped until the file is modified
+var FailedFileTarget map[string]map[string]time.Time = make(map[string]map[string]time.Time)
+
+// Locations keeps the loaded time zones by their name
+var Locations map[string]*time.Location = make(map[string]*time.Location)
+
+// LastSourceHost keeps the index of the source host which served the previous run
+var LastSourceHost map[string]int = make(map[string]int)
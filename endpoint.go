@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultEndpointCooldown is how long a failing endpoint is out of rotation, in seconds
+const DefaultEndpointCooldown = 60
+
+// EndpointPool chooses the endpoint of an upload following target.strategy,
+// endpoints which fail are out of rotation until their cooldown is over
+type EndpointPool struct {
+	strategy  string
+	endpoints []Endpoint
+	cooldown  time.Duration
+	mutex     sync.Mutex
+	next      int
+	downUntil map[string]time.Time
+}
+
+// NewEndpointPool returns endpoint pool of target.endpoints
+func NewEndpointPool(strategy string, endpoints []Endpoint, cooldown int64) *EndpointPool {
+	if cooldown <= 0 {
+		cooldown = DefaultEndpointCooldown
+	}
+
+	return &EndpointPool{
+		strategy:  strategy,
+		endpoints: endpoints,
+		cooldown:  time.Duration(cooldown) * time.Second,
+		downUntil: make(map[string]time.Time),
+	}
+}
+
+// Candidates returns the endpoints to try in order. The first one follows the strategy:
+// failover uses the first healthy endpoint, round-robin rotates and weighted picks
+// randomly by weight. Every endpoint is returned when none of them is healthy
+func (p *EndpointPool) Candidates() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	healthy := make([]Endpoint, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		if time.Now().After(p.downUntil[endpoint.URL]) {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = p.endpoints
+	}
+
+	first := 0
+	switch p.strategy {
+	case `round-robin`:
+		first = p.next % len(healthy)
+		p.next++
+		break
+	case `weighted`:
+		first = pickWeighted(healthy)
+		break
+	}
+
+	candidates := make([]string, 0, len(healthy))
+	for index := range healthy {
+		candidates = append(candidates, healthy[(first+index)%len(healthy)].URL)
+	}
+
+	return candidates
+}
+
+// MarkFailed takes an endpoint out of rotation for the cooldown period
+func (p *EndpointPool) MarkFailed(url string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.downUntil[url] = time.Now().Add(p.cooldown)
+}
+
+// MarkHealthy puts an endpoint back into rotation
+func (p *EndpointPool) MarkHealthy(url string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.downUntil, url)
+}
+
+// pickWeighted returns the index of an endpoint chosen randomly by weight, weight defaults to 1
+func pickWeighted(endpoints []Endpoint) int {
+	total := 0
+	for _, endpoint := range endpoints {
+		total += endpointWeight(endpoint)
+	}
+
+	pick := rand.Intn(total)
+	for index, endpoint := range endpoints {
+		pick -= endpointWeight(endpoint)
+		if pick < 0 {
+			return index
+		}
+	}
+
+	return 0
+}
+
+func endpointWeight(endpoint Endpoint) int {
+	if endpoint.Weight <= 0 {
+		return 1
+	}
+
+	return endpoint.Weight
+}
+
+// isEndpointError checks whether an upload failed because of the endpoint,
+// e.g. it is not reachable or responds with a server error
+func isEndpointError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == 429
+	}
+
+	switch ErrorClass(err) {
+	case `timeout`, `connection`, `dns`, `tls`:
+		return true
+	}
+
+	return false
+}
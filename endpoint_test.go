@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testEndpoints = []Endpoint{{URL: "https://a.example.com"}, {URL: "https://b.example.com"}, {URL: "https://c.example.com"}}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	pool := NewEndpointPool("failover", testEndpoints, 0)
+	assert.Equal(t, DefaultEndpointCooldown*time.Second, pool.cooldown)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, pool.Candidates())
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, pool.Candidates())
+
+	pool.MarkFailed("https://a.example.com")
+	assert.Equal(t, []string{"https://b.example.com", "https://c.example.com"}, pool.Candidates())
+
+	pool.MarkHealthy("https://a.example.com")
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, pool.Candidates())
+}
+
+func TestEndpointPoolCooldown(t *testing.T) {
+	pool := NewEndpointPool("failover", testEndpoints, 60)
+	pool.cooldown = 20 * time.Millisecond
+
+	pool.MarkFailed("https://a.example.com")
+	assert.Equal(t, []string{"https://b.example.com", "https://c.example.com"}, pool.Candidates())
+
+	// The endpoint is back into rotation once its cooldown is over
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, pool.Candidates())
+}
+
+func TestEndpointPoolAllCooling(t *testing.T) {
+	pool := NewEndpointPool("failover", testEndpoints, 60)
+	for _, endpoint := range testEndpoints {
+		pool.MarkFailed(endpoint.URL)
+	}
+
+	// Every endpoint is tried when none of them is healthy
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, pool.Candidates())
+}
+
+func TestEndpointPoolRoundRobin(t *testing.T) {
+	pool := NewEndpointPool("round-robin", testEndpoints, 60)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, pool.Candidates())
+	assert.Equal(t, []string{"https://b.example.com", "https://c.example.com", "https://a.example.com"}, pool.Candidates())
+	assert.Equal(t, []string{"https://c.example.com", "https://a.example.com", "https://b.example.com"}, pool.Candidates())
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}, pool.Candidates())
+
+	// An endpoint which is cooling down is left out of the rotation
+	pool.MarkFailed("https://b.example.com")
+	assert.Equal(t, []string{"https://a.example.com", "https://c.example.com"}, pool.Candidates())
+	assert.Equal(t, []string{"https://c.example.com", "https://a.example.com"}, pool.Candidates())
+}
+
+func TestEndpointPoolWeighted(t *testing.T) {
+	pool := NewEndpointPool("weighted", []Endpoint{{URL: "https://a.example.com", Weight: 3}, {URL: "https://b.example.com"}}, 60)
+
+	picks := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		candidates := pool.Candidates()
+		assert.Len(t, candidates, 2)
+		picks[candidates[0]]++
+	}
+
+	// b has the default weight 1, so a is picked about 3 times out of 4
+	assert.InDelta(t, 3000, picks["https://a.example.com"], 200)
+	assert.InDelta(t, 1000, picks["https://b.example.com"], 200)
+
+	pool.MarkFailed("https://a.example.com")
+	assert.Equal(t, []string{"https://b.example.com"}, pool.Candidates())
+}
+
+func TestIsEndpointError(t *testing.T) {
+	assert.True(t, isEndpointError(&StatusError{StatusCode: http.StatusServiceUnavailable}))
+	assert.True(t, isEndpointError(&StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, isEndpointError(&StatusError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, isEndpointError(errors.New("template error")))
+}
+
+func TestUploadEndpointFailover(t *testing.T) {
+	requests := make([]string, 0)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, "failing")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, "healthy")
+	}))
+	defer healthy.Close()
+
+	uploader, err := NewUploader(Target{Endpoints: []Endpoint{{URL: failing.URL}, {URL: healthy.URL}}, Mode: "raw"})
+	assert.Nil(t, err)
+
+	cli := NewLocalFolder(os.TempDir())
+	data := &TemplateData{Filename: "a.csv"}
+
+	// The failing endpoint is replaced right away, then it is out of rotation
+	assert.Nil(t, uploader.uploadOnce(cli, "/dev/null", data))
+	assert.Nil(t, uploader.uploadOnce(cli, "/dev/null", data))
+	assert.Equal(t, []string{"failing", "healthy", "healthy"}, requests)
+}
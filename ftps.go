@@ -1,80 +1,57 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"regexp"
-	"strconv"
-	"strings"
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"path"
 	"time"
 
-	"github.com/webguerilla/ftps"
+	"github.com/jlaffaye/ftp"
 )
 
 // FTPS client
 type FTPS struct {
-	ftpsclient         *ftps.FTPS
+	ftpsclient         *ftp.ServerConn
 	filenameToDownload []string
-	lastFileModTime    map[string]time.Time
-	lastFileUpload     map[string]string
 }
 
-// NewFTPS initiates FTPS client
-func NewFTPS(host, port, username, password string) Interface {
-	ftpsClient := new(ftps.FTPS)
-	ftpsClient.TLSConfig.InsecureSkipVerify = true
-	ftpsClient.Debug = false
-
-	hostPort, _ := strconv.Atoi(port)
-	errConnect := ftpsClient.Connect(host, hostPort)
+// NewFTPS initiates FTPS client using explicit TLS
+func NewFTPS(host, port, username, password string, timeout time.Duration) (Interface, error) {
+	ftpsClient, errConnect := ftp.Dial(net.JoinHostPort(host, port), ftp.DialWithTimeout(timeout), ftp.DialWithExplicitTLS(&tls.Config{
+		InsecureSkipVerify: true,
+	}))
 	if errConnect != nil {
-		panic(errConnect)
+		return nil, errConnect
 	}
 
 	errLogin := ftpsClient.Login(username, password)
 	if errLogin != nil {
-		panic(errLogin)
+		ftpsClient.Quit()
+		return nil, errLogin
 	}
 
 	return &FTPS{
-		ftpsclient:      ftpsClient,
-		lastFileModTime: LastFileModTime,
-		lastFileUpload:  LastFileUpload,
-	}
+		ftpsclient: ftpsClient,
+	}, nil
 }
 
 // ReaddirSourceFolder is used to read files in a dir
 func (f *FTPS) ReaddirSourceFolder(crondata Cron) error {
 	fileToDownload := make([]string, 0)
 	if crondata.Task.FilePrefix != "" {
-		errChangeWorkingDir := f.ftpsclient.ChangeWorkingDirectory(crondata.Task.SourceFolder)
-		if errChangeWorkingDir != nil {
-			return errChangeWorkingDir
-		}
-
-		entries, errListWorkingDir := f.ftpsclient.List()
+		entries, errListWorkingDir := f.ftpsclient.List(crondata.Task.SourceFolder)
 		if errListWorkingDir != nil {
 			return errListWorkingDir
 		}
 
 		for _, item := range entries {
-			isMatch, _ := regexp.MatchString(crondata.Task.FilePrefix, item.Name)
-			isYearMatch := item.Time.Year() == time.Now().Year()
-			isMonthMatch := item.Time.Month() == time.Now().Month()
-			isDayMatch := item.Time.Day() == time.Now().Day()
-
-			prefixCodes := strings.Split(item.Name, crondata.Task.FilePrefixDelimiter)
-			prefixCode := prefixCodes[crondata.Task.FilePrefixIndex]
-			isFileLatestUpdate := item.Time.After(f.lastFileModTime[prefixCode])
-			isPrevFileDifferent := f.lastFileUpload[prefixCode] != item.Name
-
-			if !isPrevFileDifferent {
+			if item.Type != ftp.EntryTypeFile {
 				continue
 			}
 
-			if isMatch && isYearMatch && isMonthMatch && isDayMatch && isFileLatestUpdate && isPrevFileDifferent {
-				f.lastFileModTime[prefixCode] = item.Time
-				f.lastFileUpload[prefixCode] = item.Name
+			if isFileToDownload(crondata, item.Name, item.Time) {
 				fileToDownload = append(fileToDownload, item.Name)
 			}
 		}
@@ -84,7 +61,6 @@ func (f *FTPS) ReaddirSourceFolder(crondata Cron) error {
 
 	f.SetFilenameToDownload(fileToDownload)
 
-
 	return nil
 }
 
@@ -98,23 +74,30 @@ func (f *FTPS) GetFilenameToDownload() []string {
 	return f.filenameToDownload
 }
 
-// DownloadTempFile will download the file
-func (f *FTPS) DownloadTempFile(filepath string) error {
-	Logf("Downloading file=%s ...\n", filepath)
+// ReadFile opens the file for a streaming read, it must be closed
+// before another command is sent to the server
+func (f *FTPS) ReadFile(filepath string) (io.ReadCloser, error) {
+	Logf("Reading file=%s ...\n", filepath)
 
-	sourceFile, errSourceFile := f.ftpsclient.RetrieveFileData(filepath)
+	sourceFile, errSourceFile := f.ftpsclient.Retr(filepath)
 	if errSourceFile != nil {
-		return errSourceFile
+		return nil, errSourceFile
 	}
 
-	tempfile := fmt.Sprintf("./%s", f.GetFilenameToDownload())
-	errWriteFile := ioutil.WriteFile(tempfile, sourceFile, 0644)
-	if errWriteFile != nil {
-		return errWriteFile
+	return sourceFile, nil
+}
+
+// Stat returns the size and modified time of a file using SIZE and MDTM,
+// the modified time is zero when the server does not support MDTM
+func (f *FTPS) Stat(filepath string) (os.FileInfo, error) {
+	size, errSize := f.ftpsclient.FileSize(filepath)
+	if errSize != nil {
+		return nil, errSize
 	}
 
-	Log("File has been downloaded succesfully ...")
-	return nil
+	modTime, _ := f.ftpsclient.GetTime(filepath)
+
+	return &fileInfo{name: path.Base(filepath), size: size, modTime: modTime}, nil
 }
 
 // Close is used to close a connection
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotModified is returned when the source file has not changed since the last download
+var ErrNotModified = errors.New("file is not modified")
+
+var (
+	autoindexLinkPattern = regexp.MustCompile(`(?is)<a\s[^>]*href="([^"?#]+)"[^>]*>.*?</a>`)
+	autoindexTagPattern  = regexp.MustCompile(`<[^>]*>`)
+	autoindexDatePattern = regexp.MustCompile(`\d{2}-[A-Za-z]{3}-\d{4} \d{2}:\d{2}|\d{4}-\d{2}-\d{2} \d{2}:\d{2}`)
+	autoindexSizePattern = regexp.MustCompile(`\s(\d+)\s*$`)
+	linkNextPattern      = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="?next"?`)
+)
+
+// HTTP client polls a json listing endpoint or an autoindex html page
+type HTTP struct {
+	httpclient         *http.Client
+	host               string
+	username           string
+	password           string
+	header             []map[string]string
+	listing            SourceListing
+	job                Cron
+	files              map[string]httpFile
+	filenameToDownload []string
+}
+
+type httpFile struct {
+	name         string
+	url          string
+	size         int64
+	modTime      time.Time
+	etag         string
+	lastModified string
+}
+
+// NewHTTP initiates HTTP/HTTPS polling client
+func NewHTTP(host, username, password string, header []map[string]string, listing SourceListing, timeout time.Duration) Interface {
+	return &HTTP{
+		httpclient: NewSourceHTTPClient(timeout),
+		host:       host,
+		username:   username,
+		password:   password,
+		header:     header,
+		listing:    listing,
+		files:      make(map[string]httpFile),
+	}
+}
+
+// ReaddirSourceFolder is used to read files from the listing endpoint
+func (h *HTTP) ReaddirSourceFolder(crondata Cron) error {
+	h.job = crondata
+	fileToDownload := make([]string, 0)
+	listingURL := h.join(h.host, crondata.Task.SourceFolder)
+
+	if crondata.Task.FilePrefix != "" {
+		var files []httpFile
+		var err error
+
+		// Listed dates without a time zone are in the job time zone
+		location := jobLocation(crondata)
+		if h.listing.Format == `autoindex` {
+			files, err = h.readAutoindex(listingURL, location)
+		} else {
+			files, err = h.readJSON(listingURL, location)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, item := range files {
+			filename := item.name
+			if item.modTime.IsZero() {
+				item.modTime = h.lastModified(item.url)
+			}
+
+			if isFileToDownload(crondata, filename, item.modTime) {
+				h.files[filename] = item
+				fileToDownload = append(fileToDownload, filename)
+			}
+		}
+	} else {
+		h.files[crondata.Task.File] = httpFile{name: crondata.Task.File, url: h.join(listingURL, crondata.Task.File)}
+		fileToDownload = append(fileToDownload, crondata.Task.File)
+	}
+
+	h.SetFilenameToDownload(fileToDownload)
+
+	return nil
+}
+
+func (h *HTTP) readJSON(listingURL string, location *time.Location) ([]httpFile, error) {
+	files := make([]httpFile, 0)
+	nextURL := listingURL
+
+	for nextURL != "" {
+		resp, err := h.do("GET", nextURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var data interface{}
+		errDecode := json.NewDecoder(resp.Body).Decode(&data)
+		resp.Body.Close()
+		if errDecode != nil {
+			return nil, errDecode
+		}
+
+		items, err := JSONPath(data, h.listing.Items)
+		if err != nil {
+			return nil, err
+		}
+
+		list, ok := items.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("listing items=%s is not an array", h.listing.Items)
+		}
+
+		for _, item := range list {
+			name := JSONPathString(item, h.listing.Name)
+			fileURL := JSONPathString(item, h.listing.URL)
+			if fileURL == "" {
+				fileURL = name
+			}
+			if fileURL == "" {
+				continue
+			}
+
+			fileURL = h.resolve(nextURL, fileURL)
+			if name == "" {
+				name = h.basename(fileURL)
+			}
+
+			size, _ := strconv.ParseInt(JSONPathString(item, h.listing.Size), 10, 64)
+			files = append(files, httpFile{
+				name:    name,
+				url:     fileURL,
+				size:    size,
+				modTime: h.parseModified(JSONPathString(item, h.listing.Modified), location),
+			})
+		}
+
+		next := ""
+		if h.listing.Next != "" {
+			next = JSONPathString(data, h.listing.Next)
+		} else if match := linkNextPattern.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			next = match[1]
+		}
+
+		if next != "" {
+			next = h.resolve(nextURL, next)
+		}
+		nextURL = next
+	}
+
+	return files, nil
+}
+
+func (h *HTTP) readAutoindex(listingURL string, location *time.Location) ([]httpFile, error) {
+	resp, err := h.do("GET", listingURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]httpFile, 0)
+	links := autoindexLinkPattern.FindAllSubmatchIndex(page, -1)
+	for i, link := range links {
+		href := string(page[link[2]:link[3]])
+		if strings.HasSuffix(href, "/") || strings.HasPrefix(href, "..") {
+			continue
+		}
+
+		end := len(page)
+		if i+1 < len(links) {
+			end = links[i+1][0]
+		}
+		text := autoindexTagPattern.ReplaceAllString(string(page[link[1]:end]), " ")
+
+		fileURL := h.join(listingURL, href)
+		item := httpFile{name: h.basename(fileURL), url: fileURL}
+		if date := autoindexDatePattern.FindString(text); date != "" {
+			item.modTime = h.parseModified(date, location)
+		}
+		if size := autoindexSizePattern.FindStringSubmatch(strings.TrimSpace(text)); size != nil {
+			item.size, _ = strconv.ParseInt(size[1], 10, 64)
+		}
+
+		files = append(files, item)
+	}
+
+	return files, nil
+}
+
+// lastModified asks the server for Last-Modified when the listing does not include it
+func (h *HTTP) lastModified(fileURL string) time.Time {
+	resp, err := h.do("HEAD", fileURL, nil)
+	if err != nil {
+		return time.Time{}
+	}
+	resp.Body.Close()
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return modTime
+}
+
+// parseModified parses a listed modified time, a time without a time zone is in location
+func (h *HTTP) parseModified(value string, location *time.Location) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0)
+	}
+
+	// http dates are always in GMT
+	if modTime, err := http.ParseTime(value); err == nil {
+		return modTime
+	}
+
+	layouts := []string{time.RFC3339, "02-Jan-2006 15:04", "2006-01-02 15:04"}
+	if h.listing.ModifiedLayout != "" {
+		layouts = append([]string{h.listing.ModifiedLayout}, layouts...)
+	}
+
+	for _, layout := range layouts {
+		if modTime, err := time.ParseInLocation(layout, value, location); err == nil {
+			return modTime
+		}
+	}
+
+	return time.Time{}
+}
+
+// resolve resolves a link found in a response against the url of that response
+func (h *HTTP) resolve(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return baseURL.ResolveReference(refURL).String()
+}
+
+// join treats base as a folder and resolves name inside it
+func (h *HTTP) join(base, name string) string {
+	if name == "" {
+		return base
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return name
+	}
+
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path = baseURL.Path + "/"
+	}
+
+	return h.resolve(baseURL.String(), strings.TrimPrefix(name, "/"))
+}
+
+func (h *HTTP) basename(fileURL string) string {
+	parsedURL, err := url.Parse(fileURL)
+	if err != nil {
+		return path.Base(fileURL)
+	}
+
+	name, err := url.PathUnescape(path.Base(parsedURL.Path))
+	if err != nil {
+		return path.Base(parsedURL.Path)
+	}
+
+	return name
+}
+
+func (h *HTTP) do(method, requestURL string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(method, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range h.header {
+		req.Header.Set(item["key"], item["value"])
+	}
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	if h.username != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+
+	resp, err := h.httpclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, ErrNotModified
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status_code=%d from url=%s", resp.StatusCode, requestURL)
+	}
+
+	return resp, nil
+}
+
+// SetFilenameToDownload is used to set a filename to download as temp file
+func (h *HTTP) SetFilenameToDownload(filename []string) {
+	h.filenameToDownload = filename
+}
+
+// GetFilenameToDownload is used to get a filename to download as temp file
+func (h *HTTP) GetFilenameToDownload() []string {
+	return h.filenameToDownload
+}
+
+// ReadFile opens the file for a streaming read using a conditional request,
+// ErrNotModified is returned when the file has the same ETag or Last-Modified as the previous upload
+func (h *HTTP) ReadFile(filepath string) (io.ReadCloser, error) {
+	Logf("Reading file=%s ...\n", filepath)
+
+	filename := path.Base(filepath)
+	file, ok := h.files[filename]
+	if !ok {
+		file = httpFile{name: filename, url: h.join(h.host, filepath)}
+	}
+
+	// The previous upload is kept per job, jobs may read the same url
+	key := fileKey(h.job, file.url)
+	header := http.Header{}
+	if etag := LastFileETag[key]; etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if modified := LastFileModified[key]; modified != "" {
+		header.Set("If-Modified-Since", modified)
+	}
+
+	resp, err := h.do("GET", file.url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	file.etag = resp.Header.Get("ETag")
+	file.lastModified = resp.Header.Get("Last-Modified")
+	h.files[filename] = file
+
+	return resp.Body, nil
+}
+
+// Archive remembers ETag and Last-Modified of an uploaded file for the next conditional request
+func (h *HTTP) Archive(filepath, archiveFolder string) error {
+	file, ok := h.files[path.Base(filepath)]
+	if !ok {
+		return nil
+	}
+
+	key := fileKey(h.job, file.url)
+	LastFileETag[key] = file.etag
+	LastFileModified[key] = file.lastModified
+
+	return nil
+}
+
+// Stat returns the size and modified time of a file from the listing
+func (h *HTTP) Stat(filepath string) (os.FileInfo, error) {
+	file, ok := h.files[path.Base(filepath)]
+	if !ok {
+		return nil, fmt.Errorf("file %s is not found in listing", path.Base(filepath))
+	}
+
+	return &fileInfo{name: file.name, size: file.size, modTime: file.modTime}, nil
+}
+
+// Close for http is do nothing
+func (h *HTTP) Close() {}
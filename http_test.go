@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSourceTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stalled.csv" {
+			w.Write([]byte("id,amount\n"))
+			w.(http.Flusher).Flush()
+		}
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	source := NewHTTP(server.URL, "", "", nil, SourceListing{Items: "files"}, 100*time.Millisecond)
+
+	startedAt := time.Now()
+	err := source.ReaddirSourceFolder(Cron{Task: CronTask{FilePrefix: `.csv$`}})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(startedAt) < 5*time.Second)
+
+	body, err := source.ReadFile("/stalled.csv")
+	assert.Nil(t, err)
+	defer body.Close()
+
+	_, err = ioutil.ReadAll(body)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPSourceNotModifiedPerJob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("id,amount\n"))
+	}))
+	defer server.Close()
+
+	read := func(crondata Cron) error {
+		source := NewHTTP(server.URL, "", "", nil, SourceListing{}, time.Second)
+		assert.Nil(t, source.ReaddirSourceFolder(crondata))
+
+		body, err := source.ReadFile("/a.csv")
+		if err != nil {
+			return err
+		}
+		body.Close()
+
+		return source.(Archiver).Archive("/a.csv", "")
+	}
+
+	vendorA := Cron{Name: "vendor-a", Task: CronTask{File: "a.csv"}}
+	vendorB := Cron{Name: "vendor-b", Task: CronTask{File: "a.csv"}}
+
+	// The ETag of an uploaded file is only sent again by the job which uploaded it
+	assert.Nil(t, read(vendorA))
+	assert.Equal(t, ErrNotModified, read(vendorA))
+	assert.Nil(t, read(vendorB))
+	assert.Equal(t, ErrNotModified, read(vendorB))
+}
+
+func TestHTTPSourceFailover(t *testing.T) {
+	requests := map[string]int{}
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests["primary"]++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests["secondary"]++
+		w.Write([]byte(`{"files": []}`))
+	}))
+	defer secondary.Close()
+
+	source := Source{
+		Type:    "http",
+		Hosts:   []SourceHost{{Host: primary.URL}, {Host: secondary.URL}},
+		Listing: SourceListing{Items: "$.files"},
+	}
+	crondata := Cron{Name: "failover", Task: CronTask{FilePrefix: `.csv$`}}
+
+	// A host which fails to list is failed over, the next run starts from the host which served
+	for run := 0; run < 2; run++ {
+		cli, err := InitiateFTPClient("http", source, crondata)
+		assert.Nil(t, err)
+		assert.Empty(t, cli.GetFilenameToDownload())
+		cli.Close()
+	}
+	assert.Equal(t, map[string]int{"primary": 1, "secondary": 2}, requests)
+	delete(LastSourceHost, "http/"+primary.URL)
+
+	secondary.Close()
+	_, err := InitiateFTPClient("http", source, crondata)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPParseModified(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	assert.Nil(t, err)
+
+	source := NewHTTP("http://files.example.com", "", "", nil, SourceListing{ModifiedLayout: "02/01/2006 15:04"}, time.Second).(*HTTP)
+
+	// Dates without a time zone are in the job time zone
+	assert.Equal(t, time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), source.parseModified("2026-10-19 08:00", jakarta).UTC())
+	assert.Equal(t, time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), source.parseModified("19-Oct-2026 08:00", jakarta).UTC())
+	assert.Equal(t, time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), source.parseModified("19/10/2026 08:00", jakarta).UTC())
+
+	// Dates with a time zone are kept
+	assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), source.parseModified("2026-10-19T08:00:00Z", jakarta).UTC())
+	assert.Equal(t, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), source.parseModified("Mon, 19 Oct 2026 08:00:00 GMT", jakarta).UTC())
+	assert.Equal(t, time.Unix(1760832000, 0), source.parseModified("1760832000", jakarta))
+	assert.True(t, source.parseModified("yesterday", jakarta).IsZero())
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	_ "github.com/emersion/go-message/charset"
+)
+
+// IMAP client reads attachments of unseen messages in a mailbox
+type IMAP struct {
+	imapclient         *client.Client
+	attachments        map[string]imapPart
+	unarchived         map[uint32]map[string]bool
+	archived           map[string]*imap.SeqSet
+	filenameToDownload []string
+}
+
+// NewIMAP initiates IMAP client over TLS
+func NewIMAP(host, port, username, password string, timeout time.Duration) (Interface, error) {
+	if port == "" {
+		port = "993"
+	}
+
+	imapclient, errDial := client.DialWithDialerTLS(&net.Dialer{Timeout: timeout}, net.JoinHostPort(host, port), nil)
+	if errDial != nil {
+		return nil, errDial
+	}
+
+	errLogin := imapclient.Login(username, password)
+	if errLogin != nil {
+		imapclient.Logout()
+		return nil, errLogin
+	}
+
+	return &IMAP{
+		imapclient:  imapclient,
+		attachments: make(map[string]imapPart),
+		unarchived:  make(map[uint32]map[string]bool),
+		archived:    make(map[string]*imap.SeqSet),
+	}, nil
+}
+
+// imapPart is an attachment of a message, attachments are listed as `<uid>/<part>/<filename>`
+// so attachments with the same name in several messages are all downloaded
+type imapPart struct {
+	uid      uint32
+	part     []int
+	filename string
+	encoding string
+}
+
+// ReaddirSourceFolder searches unseen messages in the mailbox matching sender and subject,
+// each attachment is treated as a file using the message date as its modified time
+func (i *IMAP) ReaddirSourceFolder(crondata Cron) error {
+	fileToDownload := make([]string, 0)
+
+	_, errSelect := i.imapclient.Select(imapMailbox(crondata.Task.SourceFolder), false)
+	if errSelect != nil {
+		return errSelect
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	if crondata.Task.Sender != "" {
+		criteria.Header.Add("From", crondata.Task.Sender)
+	}
+	if crondata.Task.Subject != "" {
+		criteria.Header.Add("Subject", crondata.Task.Subject)
+	}
+
+	uids, errSearch := i.imapclient.UidSearch(criteria)
+	if errSearch != nil {
+		return errSearch
+	}
+
+	if len(uids) == 0 {
+		i.SetFilenameToDownload(fileToDownload)
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- i.imapclient.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, imap.FetchBodyStructure}, messages)
+	}()
+
+	for message := range messages {
+		if message.BodyStructure == nil {
+			continue
+		}
+
+		message.BodyStructure.Walk(func(partPath []int, part *imap.BodyStructure) bool {
+			filename, _ := part.Filename()
+			if filename == "" {
+				return true
+			}
+
+			listedName := fmt.Sprintf("%d/%s/%s", message.Uid, imapPartPath(partPath), filename)
+
+			isFile := filename == crondata.Task.File
+			if crondata.Task.FilePrefix != "" {
+				isFile = isAttachmentToDownload(crondata, listedName, filename, message.InternalDate)
+			}
+
+			if isFile {
+				i.attachments[listedName] = imapPart{uid: message.Uid, part: partPath, filename: filename, encoding: strings.ToLower(part.Encoding)}
+				if i.unarchived[message.Uid] == nil {
+					i.unarchived[message.Uid] = make(map[string]bool)
+				}
+				i.unarchived[message.Uid][listedName] = true
+				fileToDownload = append(fileToDownload, listedName)
+			}
+
+			return true
+		})
+	}
+
+	errFetch := <-done
+	if errFetch != nil {
+		return errFetch
+	}
+
+	i.SetFilenameToDownload(fileToDownload)
+
+	return nil
+}
+
+// SetFilenameToDownload is used to set a filename to download as temp file
+func (i *IMAP) SetFilenameToDownload(filename []string) {
+	i.filenameToDownload = filename
+}
+
+// GetFilenameToDownload is used to get a filename to download as temp file
+func (i *IMAP) GetFilenameToDownload() []string {
+	return i.filenameToDownload
+}
+
+// ReadFile fetches only the body part of the attachment without marking the message as seen.
+// The imap library reads the fetched part into memory, so an attachment is not streamed
+func (i *IMAP) ReadFile(filepath string) (io.ReadCloser, error) {
+	Logf("Reading file=%s ...\n", filepath)
+
+	attachment, ok := i.attachments[filepath]
+	if !ok {
+		return nil, fmt.Errorf("attachment %s is not found", filepath)
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(attachment.uid)
+
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Path: attachment.part}, Peek: true}
+	messages := make(chan *imap.Message, 1)
+	errFetch := i.imapclient.UidFetch(seqset, []imap.FetchItem{section.FetchItem()}, messages)
+	if errFetch != nil {
+		return nil, errFetch
+	}
+
+	message := <-messages
+	if message == nil {
+		return nil, fmt.Errorf("message uid=%d is not found", attachment.uid)
+	}
+
+	body := message.GetBody(section)
+	if body == nil {
+		return nil, fmt.Errorf("message uid=%d has no part=%s", attachment.uid, imapPartPath(attachment.part))
+	}
+
+	switch attachment.encoding {
+	case `base64`:
+		return ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, body)), nil
+	case `quoted-printable`:
+		return ioutil.NopCloser(quotedprintable.NewReader(body)), nil
+	}
+
+	return ioutil.NopCloser(body), nil
+}
+
+// Archive marks the message of an uploaded attachment as seen once every selected attachment
+// of the message is uploaded, so a message with a failed attachment is read again next run.
+// The message is moved into the archive folder when the connection is closed
+func (i *IMAP) Archive(filepath, archiveFolder string) error {
+	attachment, ok := i.attachments[filepath]
+	if !ok {
+		return fmt.Errorf("attachment %s is not found", filepath)
+	}
+
+	delete(i.unarchived[attachment.uid], filepath)
+	if len(i.unarchived[attachment.uid]) > 0 {
+		return nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(attachment.uid)
+
+	errStore := i.imapclient.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil)
+	if errStore != nil {
+		return errStore
+	}
+
+	if archiveFolder != "" {
+		mailbox := imapMailbox(archiveFolder)
+		if i.archived[mailbox] == nil {
+			i.archived[mailbox] = new(imap.SeqSet)
+		}
+		i.archived[mailbox].AddNum(attachment.uid)
+	}
+
+	return nil
+}
+
+// Close moves archived messages and logs out
+func (i *IMAP) Close() {
+	for mailbox, seqset := range i.archived {
+		_ = i.imapclient.Create(mailbox)
+
+		errMove := i.move(seqset, mailbox)
+		if errMove != nil {
+			Logf("Failed to move messages to mailbox=%s error=%s\n", mailbox, errMove.Error())
+		}
+	}
+
+	i.imapclient.Logout()
+}
+
+// move uses MOVE, when the server does not support it the messages are copied,
+// then deleted and expunged
+func (i *IMAP) move(seqset *imap.SeqSet, mailbox string) error {
+	isMove, errSupport := i.imapclient.Support("MOVE")
+	if errSupport == nil && isMove {
+		errMove := i.imapclient.UidMove(seqset, mailbox)
+		if errMove == nil {
+			return nil
+		}
+		Logf("Failed to move messages to mailbox=%s error=%s, copying them instead\n", mailbox, errMove.Error())
+	}
+
+	errCopy := i.imapclient.UidCopy(seqset, mailbox)
+	if errCopy != nil {
+		return errCopy
+	}
+
+	errStore := i.imapclient.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil)
+	if errStore != nil {
+		return errStore
+	}
+
+	return i.imapclient.Expunge(nil)
+}
+
+// imapPartPath formats the path of a body part, e.g. `2.1`
+func imapPartPath(partPath []int) string {
+	parts := make([]string, 0, len(partPath))
+	for _, part := range partPath {
+		parts = append(parts, strconv.Itoa(part))
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// imapMailbox converts a folder path into a mailbox name, INBOX is used by default
+func imapMailbox(folder string) string {
+	mailbox := strings.Trim(folder, "/")
+	if mailbox == "" {
+		return "INBOX"
+	}
+
+	return mailbox
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func imapTestMessage(subject string, attachments ...string) []byte {
+	message := "From: reports@partner.com\r\n" +
+		"To: kintoun@example.com\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: multipart/mixed; boundary=frontier\r\n" +
+		"\r\n" +
+		"--frontier\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Daily report\r\n"
+	for _, attachment := range attachments {
+		message += "--frontier\r\n" +
+			"Content-Type: text/csv\r\n" +
+			"Content-Disposition: attachment; filename=\"report.csv\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			attachment + "\r\n"
+	}
+
+	return []byte(message + "--frontier--\r\n")
+}
+
+func newTestIMAP(t *testing.T, addr string) *IMAP {
+	imapclient, err := client.Dial(addr)
+	assert.Nil(t, err)
+	assert.Nil(t, imapclient.Login("username", "password"))
+
+	return &IMAP{
+		imapclient:  imapclient,
+		attachments: make(map[string]imapPart),
+		unarchived:  make(map[uint32]map[string]bool),
+		archived:    make(map[string]*imap.SeqSet),
+	}
+}
+
+func TestIMAPAttachmentsWithSameName(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	imapserver := server.New(memory.New())
+	imapserver.AllowInsecureAuth = true
+	go imapserver.Serve(listener)
+	defer imapserver.Close()
+
+	source := newTestIMAP(t, listener.Addr().String())
+
+	// "aWQsYW1vdW50CjEsMTAK" is "id,amount\n1,10\n", "aWQsYW1vdW50CjIsMjAK" is "id,amount\n2,20\n"
+	assert.Nil(t, source.imapclient.Append("INBOX", nil, time.Now(), bytes.NewBuffer(imapTestMessage("Daily Report", "aWQsYW1v\r\ndW50CjEsMTAK"))))
+	assert.Nil(t, source.imapclient.Append("INBOX", nil, time.Now(), bytes.NewBuffer(imapTestMessage("Daily Report", "aWQsYW1vdW50CjIsMjAK"))))
+
+	crondata := Cron{Name: "imap-same-name", Task: CronTask{
+		SourceFolder:        "INBOX",
+		FilePrefix:          `report.csv$`,
+		FilePrefixDelimiter: ".",
+		ArchiveFolder:       "Processed",
+	}}
+	assert.Nil(t, source.ReaddirSourceFolder(crondata))
+
+	filenames := source.GetFilenameToDownload()
+	assert.Equal(t, []string{"7/2/report.csv", "8/2/report.csv"}, filenames)
+
+	contents := make([]string, 0)
+	for _, filename := range filenames {
+		body, err := source.ReadFile(filename)
+		assert.Nil(t, err)
+		content, err := ioutil.ReadAll(body)
+		assert.Nil(t, err)
+		body.Close()
+		contents = append(contents, string(content))
+
+		assert.Nil(t, source.Archive(filename, crondata.Task.ArchiveFolder))
+		markFileProcessed(crondata, filename)
+	}
+	assert.Equal(t, []string{"id,amount\n1,10\n", "id,amount\n2,20\n"}, contents)
+
+	source.Close()
+
+	// A new message with an attachment of the same name is downloaded on the next run,
+	// a message is only archived once every selected attachment of it is archived
+	source = newTestIMAP(t, listener.Addr().String())
+	assert.Nil(t, source.imapclient.Append("INBOX", nil, time.Now(), bytes.NewBuffer(imapTestMessage("Daily Report", "aWQsYW1vdW50CjEsMTAK"))))
+	assert.Nil(t, source.imapclient.Append("INBOX", nil, time.Now(), bytes.NewBuffer(imapTestMessage("Daily Report", "aWQsYW1vdW50CjEsMTAK", "aWQsYW1vdW50CjIsMjAK"))))
+
+	assert.Nil(t, source.ReaddirSourceFolder(crondata))
+	// The memory backend gives the new messages the uids of the moved messages again
+	assert.Equal(t, []string{"7/2/report.csv", "8/2/report.csv", "8/3/report.csv"}, source.GetFilenameToDownload())
+
+	assert.Nil(t, source.Archive("7/2/report.csv", crondata.Task.ArchiveFolder))
+	assert.Nil(t, source.Archive("8/2/report.csv", crondata.Task.ArchiveFolder))
+	source.Close()
+
+	imapclient, err := client.Dial(listener.Addr().String())
+	assert.Nil(t, err)
+	defer imapclient.Logout()
+	assert.Nil(t, imapclient.Login("username", "password"))
+
+	status, err := imapclient.Select("Processed", true)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), status.Messages)
+
+	status, err = imapclient.Select("INBOX", true)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), status.Messages)
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	criteria.Header.Add("Subject", "Daily Report")
+	uids, err := imapclient.UidSearch(criteria)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint32{8}, uids)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONPath returns the value at path in a decoded json document
+// It supports a subset of JSONPath: the root `$`, `.field`, `['field']` and `[index]`
+func JSONPath(data interface{}, path string) (interface{}, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	if path != "" && path[0] != '.' && path[0] != '[' {
+		path = "." + path
+	}
+
+	current := data
+	for path != "" {
+		var key string
+		index := -1
+
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			key = path[:end]
+			path = path[end:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path, missing ] in %s", path)
+			}
+			token := path[1:end]
+			path = path[end+1:]
+
+			if strings.HasPrefix(token, "'") || strings.HasPrefix(token, `"`) {
+				key = strings.Trim(token, `'"`)
+			} else {
+				i, err := strconv.Atoi(token)
+				if err != nil {
+					return nil, fmt.Errorf("invalid json path index %s", token)
+				}
+				index = i
+			}
+		default:
+			return nil, fmt.Errorf("invalid json path near %s", path)
+		}
+
+		if index >= 0 {
+			items, ok := current.([]interface{})
+			if !ok || index >= len(items) {
+				return nil, fmt.Errorf("json path index %d not found", index)
+			}
+			current = items[index]
+			continue
+		}
+
+		if key == "" {
+			continue
+		}
+
+		fields, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("json path field %s not found", key)
+		}
+		value, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("json path field %s not found", key)
+		}
+		current = value
+	}
+
+	return current, nil
+}
+
+// JSONPathString returns the value at path formatted as a string,
+// an empty string is returned when the path does not exist
+func JSONPathString(data interface{}, path string) string {
+	value, err := JSONPath(data, path)
+	if err != nil {
+		return ""
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// JSONCondition evaluates a condition against a decoded json document
+// The condition is a json path compared to a json value, e.g. `$.status == "OK"`,
+// or a json path alone which is true when the value exists and is not false or null
+func JSONCondition(data interface{}, condition string) (bool, error) {
+	for _, operator := range []string{"==", "!="} {
+		index := strings.Index(condition, operator)
+		if index < 0 {
+			continue
+		}
+
+		value, err := JSONPath(data, condition[:index])
+		if err != nil {
+			value = nil
+		}
+
+		var expected interface{}
+		errExpected := json.Unmarshal([]byte(strings.TrimSpace(condition[index+len(operator):])), &expected)
+		if errExpected != nil {
+			return false, fmt.Errorf("invalid json value in condition %s", condition)
+		}
+
+		isEqual := reflect.DeepEqual(value, expected)
+		if operator == "!=" {
+			return !isEqual, nil
+		}
+		return isEqual, nil
+	}
+
+	value, err := JSONPath(data, condition)
+	if err != nil {
+		return false, nil
+	}
+
+	return value != nil && value != false, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONPath(t *testing.T) {
+	var data interface{}
+	_ = json.Unmarshal([]byte(`{"data":[{"name":"a.csv","size":12,"meta":{"ok":true}}],"next":null,"job-id":"x1"}`), &data)
+
+	assert.Equal(t, "a.csv", JSONPathString(data, "$.data[0].name"))
+	assert.Equal(t, "12", JSONPathString(data, "$.data[0].size"))
+	assert.Equal(t, "true", JSONPathString(data, "data[0].meta.ok"))
+	assert.Equal(t, "x1", JSONPathString(data, "$['job-id']"))
+	assert.Equal(t, "", JSONPathString(data, "$.next"))
+	assert.Equal(t, "", JSONPathString(data, "$.data[1].name"))
+
+	items, err := JSONPath(data, "$.data")
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+
+	_, err = JSONPath(data, "$.missing")
+	assert.NotNil(t, err)
+}
+
+func TestJSONCondition(t *testing.T) {
+	var data interface{}
+	_ = json.Unmarshal([]byte(`{"status":"OK","code":0,"errors":null}`), &data)
+
+	isMatch, err := JSONCondition(data, `$.status == "OK"`)
+	assert.Nil(t, err)
+	assert.True(t, isMatch)
+
+	isMatch, _ = JSONCondition(data, `$.status != "OK"`)
+	assert.False(t, isMatch)
+
+	isMatch, _ = JSONCondition(data, `$.code == 0`)
+	assert.True(t, isMatch)
+
+	isMatch, _ = JSONCondition(data, `$.errors`)
+	assert.False(t, isMatch)
+
+	isMatch, _ = JSONCondition(data, `$.missing == "OK"`)
+	assert.False(t, isMatch)
+
+	_, err = JSONCondition(data, `$.status == OK`)
+	assert.NotNil(t, err)
+}
@@ -1,26 +1,22 @@
 package main
 
 import (
+	"io"
 	"io/ioutil"
-	"regexp"
+	"os"
 	"strings"
-	"time"
 )
 
 // LocalFolder client
 type LocalFolder struct {
 	dirpath            string
 	filenameToDownload []string
-	lastFileModTime    map[string]time.Time
-	lastFileUpload     map[string]string
 }
 
 // NewLocalFolder initiates local folder client
 func NewLocalFolder(dirpath string) Interface {
 	return &LocalFolder{
-		dirpath:         dirpath,
-		lastFileModTime: LastFileModTime,
-		lastFileUpload:  LastFileUpload,
+		dirpath: dirpath,
 	}
 }
 
@@ -37,28 +33,14 @@ func (l *LocalFolder) ReaddirSourceFolder(crontdata Cron) error {
 
 	for _, item := range files {
 		if crontdata.Task.FilePrefix != "" {
-			isMatch, _ := regexp.MatchString(crontdata.Task.FilePrefix, item.Name())
-			isYearMatch := item.ModTime().Year() == time.Now().Year()
-			isMonthMatch := item.ModTime().Month() == time.Now().Month()
-			isDayMatch := item.ModTime().Day() == time.Now().Day()
-
-			prefixCodes := strings.Split(item.Name(), crontdata.Task.FilePrefixDelimiter)
-			if len(prefixCodes) < 2 {
-				continue
-			}
-
-			prefixCode := prefixCodes[crontdata.Task.FilePrefixIndex]
-			isFileLatestUpdate := item.ModTime().After(l.lastFileModTime[prefixCode])
-			isPrevFileDifferent := l.lastFileUpload[prefixCode] != item.Name()
-
-			if !isPrevFileDifferent {
+			// Local folder skips files without the prefix delimiter
+			if len(strings.Split(item.Name(), crontdata.Task.FilePrefixDelimiter)) < 2 {
 				continue
 			}
 
-			if isMatch && isYearMatch && isMonthMatch && isDayMatch && isFileLatestUpdate && isPrevFileDifferent {
-				l.lastFileModTime[prefixCode] = item.ModTime()
-				l.lastFileUpload[prefixCode] = item.Name()
-				fileToDownload = append(fileToDownload, l.dirpath + "/" + item.Name())
+			filepath := l.dirpath + "/" + item.Name()
+			if isListedFileToDownload(crontdata, filepath, item.Name(), item.ModTime()) {
+				fileToDownload = append(fileToDownload, filepath)
 			}
 		} else {
 			fileToDownload = append(fileToDownload, l.dirpath + "/" + crontdata.Task.File)
@@ -80,9 +62,19 @@ func (l *LocalFolder) GetFilenameToDownload() []string {
 	return l.filenameToDownload
 }
 
-// DownloadTempFile will not be used since the file is already in local directory
-func (l *LocalFolder) DownloadTempFile(filepath string) error {
-	return nil
+// ReadFile opens the file in local directory
+func (l *LocalFolder) ReadFile(filepath string) (io.ReadCloser, error) {
+	sourceFile, errSourceFile := os.Open(filepath)
+	if errSourceFile != nil {
+		return nil, errSourceFile
+	}
+
+	return sourceFile, nil
+}
+
+// Stat returns the size and modified time of a file in local directory
+func (l *LocalFolder) Stat(filepath string) (os.FileInfo, error) {
+	return os.Stat(filepath)
 }
 
 // Close for local folder is do nothing
@@ -2,12 +2,37 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"log"
+	"os"
+	_ "time/tzdata"
 )
 
 func main() {
 	var configFile string
 	var configType string
 
+	// kintoun quarantine list|retry|purge [id ...] [-config ...]
+	if len(os.Args) > 1 && os.Args[1] == "quarantine" {
+		args, err := ParseQuarantineArgs(os.Args[2:])
+		if err == flag.ErrHelp {
+			fmt.Println(QuarantineUsage)
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			fmt.Fprintln(os.Stderr, QuarantineUsage)
+			os.Exit(2)
+		}
+
+		config := NewConfig(args.ConfigFile, args.ConfigType)
+		err = RunQuarantineCommand(config, args.Action, args.IDs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	flag.StringVar(&configFile, "config", "config.yaml", "Configuration file path")
 	flag.StringVar(&configType, "config-type", "yaml", "Configuration type: yaml, yaml-base64, env")
 
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var matrixVariable = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// ExpandJobs applies defaults to every job, then expands every job with a matrix
+// into one job per matrix entry. A job with a matrix gets its own copy of source and
+// targets when it does not set them, so `${name}` is replaced in them as well
+func (c *Config) ExpandJobs() {
+	isDefaults := !reflect.ValueOf(c.Defaults).IsZero()
+
+	jobs := make([]Cron, 0, len(c.Cron))
+	for _, crondata := range c.Cron {
+		if isDefaults {
+			job := copyValue(reflect.ValueOf(c.Defaults), nil).Interface().(Cron)
+			overrideFields(&job, &crondata)
+			crondata = job
+		}
+
+		if len(crondata.Matrix) > 0 {
+			if reflect.ValueOf(crondata.Source).IsZero() {
+				crondata.Source = c.Source
+			}
+			if len(crondata.Targets) == 0 {
+				crondata.Targets = c.JobTargets(crondata)
+			}
+		}
+
+		jobs = append(jobs, expandMatrix(crondata)...)
+	}
+
+	c.Cron = jobs
+}
+
+// expandMatrix returns one job per matrix entry, `${name}` in any value of the job is
+// replaced by the variable of the entry. The variables are kept in Vars so they are
+// replaced in connections once they are resolved. Jobs are named `<name>-<values>`
+// when the name does not contain a variable
+func expandMatrix(crondata Cron) []Cron {
+	if len(crondata.Matrix) == 0 {
+		return []Cron{crondata}
+	}
+
+	jobs := make([]Cron, 0, len(crondata.Matrix))
+	for _, vars := range crondata.Matrix {
+		job := copyValue(reflect.ValueOf(crondata), vars).Interface().(Cron)
+		job.Matrix = nil
+		job.Vars = vars
+
+		if job.Name == crondata.Name {
+			job.Name = crondata.Name + "-" + matrixValues(vars)
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+// copyValue returns a deep copy of a config value with matrix variables expanded in every string
+func copyValue(value reflect.Value, vars map[string]string) reflect.Value {
+	switch value.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(expandVariables(value.String(), vars)).Convert(value.Type())
+	case reflect.Struct:
+		result := reflect.New(value.Type()).Elem()
+		for index := 0; index < value.NumField(); index++ {
+			result.Field(index).Set(copyValue(value.Field(index), vars))
+		}
+		return result
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for index := 0; index < value.Len(); index++ {
+			result.Index(index).Set(copyValue(value.Index(index), vars))
+		}
+		return result
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		result := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(copyValue(iter.Key(), vars), copyValue(iter.Value(), vars))
+		}
+		return result
+	}
+
+	return value
+}
+
+// expandVariables replaces `${name}` by its variable, unknown variables are kept as they are
+func expandVariables(text string, vars map[string]string) string {
+	if len(vars) == 0 {
+		return text
+	}
+
+	return matrixVariable.ReplaceAllStringFunc(text, func(variable string) string {
+		value, ok := vars[matrixVariable.FindStringSubmatch(variable)[1]]
+		if !ok {
+			return variable
+		}
+
+		return value
+	})
+}
+
+func matrixValues(vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := make([]string, 0, len(names))
+	for _, name := range names {
+		values = append(values, vars[name])
+	}
+
+	return strings.Join(values, "-")
+}
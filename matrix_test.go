@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandJobs(t *testing.T) {
+	config := &Config{
+		Defaults: Cron{
+			Every: 5,
+			Type:  "minute",
+			Task:  CronTask{FilePrefix: `^${channel}_\d+.csv$`},
+		},
+		Cron: []Cron{
+			{
+				Name: "statement-${channel}",
+				Task: CronTask{SourceFolder: "/dumps/${folder}"},
+				Targets: []Target{{
+					Header: []map[string]string{{"key": "X-Channel", "value": "${channel}"}},
+					Upload: []map[string]string{{"key": "name", "value": "{{.Filename}}"}},
+				}},
+				Matrix: []map[string]string{
+					{"channel": "CIMB", "folder": "cimb"},
+					{"channel": "BCA", "folder": "bca"},
+				},
+			},
+			{Name: "audit", Every: 1, Matrix: []map[string]string{{"bank": "A"}, {"bank": "B"}}},
+		},
+	}
+
+	config.ExpandJobs()
+
+	assert.Equal(t, 4, len(config.Cron))
+	assert.Equal(t, "statement-CIMB", config.Cron[0].Name)
+	assert.Equal(t, "/dumps/cimb", config.Cron[0].Task.SourceFolder)
+	assert.Equal(t, `^CIMB_\d+.csv$`, config.Cron[0].Task.FilePrefix)
+	assert.Equal(t, uint64(5), config.Cron[0].Every)
+	assert.Equal(t, "CIMB", config.Cron[0].Targets[0].Header[0]["value"])
+	assert.Equal(t, "{{.Filename}}", config.Cron[0].Targets[0].Upload[0]["value"])
+
+	assert.Equal(t, "statement-BCA", config.Cron[1].Name)
+	assert.Equal(t, "BCA", config.Cron[1].Targets[0].Header[0]["value"])
+	assert.Equal(t, `^${channel}_\d+.csv$`, config.Defaults.Task.FilePrefix)
+
+	assert.Equal(t, "audit-A", config.Cron[2].Name)
+	assert.Equal(t, "audit-B", config.Cron[3].Name)
+	assert.Equal(t, uint64(1), config.Cron[3].Every)
+	assert.Equal(t, "minute", config.Cron[3].Type)
+}
+
+func TestExpandJobsConnections(t *testing.T) {
+	config := &Config{
+		Source: Source{Type: "sftp", Host: "sftp.example.com", Folder: "/dumps/${folder}"},
+		Targets: []Target{
+			{Name: "archive", Host: "https://archive.example.com/${channel}"},
+		},
+		Connections: Connections{
+			Targets: map[string]Target{
+				"recon": {Host: "https://recon.example.com/upload", Header: []map[string]string{{"key": "X-Channel", "value": "${channel}"}}},
+			},
+		},
+		Defaults: Cron{
+			Source: Source{Listing: SourceListing{Items: "$.files", Name: "$.name"}},
+		},
+		Cron: []Cron{
+			{
+				Name:   "statement",
+				Matrix: []map[string]string{{"channel": "CIMB", "folder": "cimb"}, {"channel": "BCA", "folder": "bca"}},
+			},
+			{
+				Name:    "recon",
+				Source:  Source{Listing: SourceListing{Name: "$.filename"}},
+				Targets: []Target{{Connection: "recon"}},
+				Matrix:  []map[string]string{{"channel": "CIMB"}},
+			},
+		},
+	}
+
+	config.ExpandJobs()
+	assert.Nil(t, config.ResolveConnections())
+
+	// Top level source and targets are expanded for every matrix entry
+	assert.Equal(t, "/dumps/cimb", config.JobSource(config.Cron[0]).Folder)
+	assert.Equal(t, "/dumps/bca", config.JobSource(config.Cron[1]).Folder)
+	assert.Equal(t, "sftp.example.com", config.JobSource(config.Cron[1]).Host)
+	assert.Equal(t, "https://archive.example.com/BCA", config.JobTargets(config.Cron[1])[0].Host)
+	assert.Equal(t, "https://archive.example.com/${channel}", config.Targets[0].Host)
+
+	// Variables are replaced in the options taken from a connection
+	target := config.JobTargets(config.Cron[2])[0]
+	assert.Equal(t, "https://recon.example.com/upload", target.Host)
+	assert.Equal(t, "CIMB", target.Header[0]["value"])
+	assert.Equal(t, "${channel}", config.Connections.Targets["recon"].Header[0]["value"])
+
+	// Nested options of defaults are merged option by option
+	assert.Equal(t, "$.files", config.Cron[2].Source.Listing.Items)
+	assert.Equal(t, "$.filename", config.Cron[2].Source.Listing.Name)
+}
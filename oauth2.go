@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2TokenExpiryMargin is how long before its expiry a token is refreshed
+const OAuth2TokenExpiryMargin = 30 * time.Second
+
+// OAuth2Client gets bearer tokens using the client credentials grant,
+// the token is cached until it expires
+type OAuth2Client struct {
+	config      OAuth2
+	httpclient  *http.Client
+	mutex       sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewOAuth2Client returns oauth2 client credentials client
+func NewOAuth2Client(config OAuth2, httpclient *http.Client) *OAuth2Client {
+	return &OAuth2Client{
+		config:     config,
+		httpclient: httpclient,
+	}
+}
+
+// Token returns the cached access token, a new token is requested when it is expired
+func (o *OAuth2Client) Token() (string, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.accessToken != "" && time.Now().Before(o.expiresAt) {
+		return o.accessToken, nil
+	}
+
+	token, err := o.requestToken()
+	if err != nil {
+		return "", err
+	}
+
+	o.accessToken = token.AccessToken
+	o.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - OAuth2TokenExpiryMargin)
+	if token.ExpiresIn <= 0 {
+		// Without expires_in the token is kept until the target rejects it
+		o.expiresAt = time.Now().Add(24 * time.Hour)
+	}
+
+	return o.accessToken, nil
+}
+
+// Invalidate drops the cached token, e.g. when it is rejected by the target
+func (o *OAuth2Client) Invalidate() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.accessToken = ""
+}
+
+func (o *OAuth2Client) requestToken() (*oauth2TokenResponse, error) {
+	Logf("Requesting oauth2 token url=%s\n", o.config.TokenURL)
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(o.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+	if o.config.AuthStyle == `params` {
+		form.Set("client_id", o.config.ClientID)
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+
+	req, err := http.NewRequest("POST", o.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.config.AuthStyle != `params` {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+	}
+
+	resp, err := o.httpclient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxResponseBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body), Reason: "failed to get oauth2 token"}
+	}
+
+	var token oauth2TokenResponse
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode oauth2 token response: %s", err.Error())
+	}
+
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2 token response has no access_token")
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newOAuth2TokenServer(t *testing.T, expiresIn int, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+
+		clientID, clientSecret, isBasic := r.BasicAuth()
+		if !isBasic {
+			clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if clientID != "kintoun" || clientSecret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, *requests, expiresIn)
+	}))
+}
+
+func TestOAuth2TokenCache(t *testing.T) {
+	requests := 0
+	server := newOAuth2TokenServer(t, 3600, &requests)
+	defer server.Close()
+
+	client := NewOAuth2Client(OAuth2{TokenURL: server.URL, ClientID: "kintoun", ClientSecret: "s3cret"}, http.DefaultClient)
+
+	token, err := client.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+
+	token, err = client.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", token)
+	assert.Equal(t, 1, requests)
+
+	client.Invalidate()
+	token, err = client.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token)
+}
+
+func TestOAuth2TokenExpiry(t *testing.T) {
+	requests := 0
+	server := newOAuth2TokenServer(t, 30, &requests)
+	defer server.Close()
+
+	// A token which expires within OAuth2TokenExpiryMargin is requested again
+	client := NewOAuth2Client(OAuth2{TokenURL: server.URL, ClientID: "kintoun", ClientSecret: "s3cret"}, http.DefaultClient)
+	_, err := client.Token()
+	assert.Nil(t, err)
+	token, err := client.Token()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token)
+}
+
+func TestOAuth2AuthStyle(t *testing.T) {
+	requests := 0
+	server := newOAuth2TokenServer(t, 3600, &requests)
+	defer server.Close()
+
+	client := NewOAuth2Client(OAuth2{TokenURL: server.URL, ClientID: "kintoun", ClientSecret: "s3cret", AuthStyle: "params"}, http.DefaultClient)
+	_, err := client.Token()
+	assert.Nil(t, err)
+
+	client = NewOAuth2Client(OAuth2{TokenURL: server.URL, ClientID: "kintoun", ClientSecret: "wrong"}, http.DefaultClient)
+	_, err = client.Token()
+	statusErr, ok := err.(*StatusError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+}
+
+func TestOAuth2RetryOnUnauthorized(t *testing.T) {
+	requests := 0
+	tokenServer := newOAuth2TokenServer(t, 3600, &requests)
+	defer tokenServer.Close()
+
+	accepted := "Bearer token-2"
+	authorizations := make([]string, 0)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != accepted {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}))
+	defer target.Close()
+
+	fixture := newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host:   target.URL,
+		Mode:   "raw",
+		OAuth2: OAuth2{TokenURL: tokenServer.URL, ClientID: "kintoun", ClientSecret: "s3cret"},
+	}})
+
+	assert.Nil(t, fixture.Upload(""))
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, authorizations)
+
+	// The request is retried only once with a new token
+	accepted = ""
+	authorizations = authorizations[:0]
+	assert.NotNil(t, fixture.Upload(""))
+	assert.Equal(t, []string{"Bearer token-2", "Bearer token-3"}, authorizations)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Defaults of target.poll, in seconds
+const (
+	DefaultPollInterval = 5
+	DefaultPollTimeout  = 600
+)
+
+// poll requests the status url taken from the upload response until the status
+// reaches a terminal value of target.poll or the poll timeout is reached
+func (u *Uploader) poll(resp *http.Response, body []byte, data *TemplateData) error {
+	poll := u.target.Poll
+
+	statusURL, err := pollURL(poll, resp, body)
+	if err != nil {
+		return err
+	}
+
+	interval := time.Duration(poll.Interval) * time.Second
+	if interval <= 0 {
+		interval = DefaultPollInterval * time.Second
+	}
+	timeout := time.Duration(poll.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultPollTimeout * time.Second
+	}
+
+	Logf("Polling processing status url=%s ...\n", statusURL)
+
+	deadline := time.Now().Add(timeout)
+	var errPoll error
+	for {
+		status, statusCode, statusBody, errStatus := u.pollStatus(statusURL, data)
+		if errStatus != nil {
+			// Failed requests are tried again until the timeout
+			Logf("Failed to get processing status url=%s error=%s\n", statusURL, errStatus.Error())
+			errPoll = errStatus
+		} else {
+			Logf("Processing status=%s\n", status)
+			errPoll = fmt.Errorf("processing status=%s is not terminal", status)
+
+			for _, value := range poll.Success {
+				if status == value {
+					return nil
+				}
+			}
+			for _, value := range poll.Failure {
+				if status == value {
+					return &StatusError{StatusCode: statusCode, Body: statusBody, Reason: fmt.Sprintf("processing is failed status=%s", status)}
+				}
+			}
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("processing status is not terminal after %s: %s", timeout, errPoll.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// pollStatus requests the status url and returns the value of target.poll.status
+func (u *Uploader) pollStatus(statusURL *url.URL, data *TemplateData) (string, int, string, error) {
+	req, err := http.NewRequest("GET", statusURL.String(), nil)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	if u.isTargetHost(statusURL) {
+		err = u.setTargetHeader(req.Header, data)
+		if err != nil {
+			return "", 0, "", err
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := u.httpclient.Do(req)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := checkResponse(resp, Success{})
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	var statusData interface{}
+	err = json.Unmarshal(body, &statusData)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to decode processing status: %s", err.Error())
+	}
+
+	return JSONPathString(statusData, u.target.Poll.Status), resp.StatusCode, string(body), nil
+}
+
+// pollURL returns the status url from a response header or a json path on the response body,
+// a relative url is resolved against the upload url
+func pollURL(poll Poll, resp *http.Response, body []byte) (*url.URL, error) {
+	value := ""
+	if poll.Header != "" {
+		value = resp.Header.Get(poll.Header)
+	} else {
+		var data interface{}
+		err := json.Unmarshal(body, &data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response body: %s", err.Error())
+		}
+		value = JSONPathString(data, poll.JSON)
+	}
+
+	if value == "" {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body), Reason: "status url is not found in response"}
+	}
+
+	return resp.Request.URL.Parse(value)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadPollHeader(t *testing.T) {
+	states := []string{"processing", "done"}
+	authorizations := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			// A relative status url is resolved against the upload url
+			w.Header().Set("Location", "status/1")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		assert.Equal(t, "/v1/status/1", r.URL.Path)
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		fmt.Fprintf(w, `{"job": {"state": "%s"}}`, states[len(authorizations)-1])
+	}))
+	defer server.Close()
+
+	fixture := newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host:   server.URL + "/v1/upload",
+		Mode:   "raw",
+		Header: []map[string]string{{"key": "Authorization", "value": "Bearer s3cret"}},
+		Poll:   Poll{Header: "Location", Status: "$.job.state", Success: []string{"done"}, Failure: []string{"failed"}, Interval: 1},
+	}})
+
+	assert.Nil(t, fixture.Upload(""))
+	assert.Equal(t, []string{"Bearer s3cret", "Bearer s3cret"}, authorizations)
+}
+
+func TestUploadPollJSON(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := newOAuth2TokenServer(t, 3600, &tokenRequests)
+	defer tokenServer.Close()
+
+	state := "done"
+	headers := make([]http.Header, 0)
+	status := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		fmt.Fprintf(w, `{"state": "%s"}`, state)
+	}))
+	defer status.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+		fmt.Fprintf(w, `{"links": {"status": "%s/jobs/7"}}`, status.URL)
+	}))
+	defer server.Close()
+
+	fixture := newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host:   server.URL,
+		Mode:   "raw",
+		Header: []map[string]string{{"key": "X-Api-Key", "value": "s3cret"}},
+		OAuth2: OAuth2{TokenURL: tokenServer.URL, ClientID: "kintoun", ClientSecret: "s3cret"},
+		Poll:   Poll{JSON: "$.links.status", Status: "$.state", Success: []string{"done"}, Failure: []string{"failed"}},
+	}})
+
+	// target.header and the oauth2 token are not sent to a status url on another host
+	assert.Nil(t, fixture.Upload(""))
+	assert.Len(t, headers, 1)
+	assert.Empty(t, headers[0].Get("Authorization"))
+	assert.Empty(t, headers[0].Get("X-Api-Key"))
+
+	state = "failed"
+	err := fixture.Upload("")
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusOK, statusErr.StatusCode)
+	assert.Equal(t, `{"state": "failed"}`, statusErr.Body)
+	assert.Len(t, headers, 2)
+}
+
+func TestUploadPollTimeout(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Header().Set("Location", "/status/1")
+			return
+		}
+
+		requests++
+		fmt.Fprint(w, `{"state": "processing"}`)
+	}))
+	defer server.Close()
+
+	fixture := newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host: server.URL,
+		Mode: "raw",
+		Poll: Poll{Header: "Location", Status: "$.state", Success: []string{"done"}, Interval: 1, Timeout: 1},
+	}})
+
+	err := fixture.Upload("")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "processing status is not terminal after 1s"))
+	assert.Equal(t, 1, requests)
+
+	// A response without the status url fails the upload
+	fixture = newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host: server.URL,
+		Mode: "raw",
+		Poll: Poll{Header: "Content-Location", Status: "$.state", Success: []string{"done"}},
+	}})
+	err = fixture.Upload("")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "status url is not found"))
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuarantineRecord is the json sidecar written next to a quarantined file
+type QuarantineRecord struct {
+	ID            string    `json:"id"`
+	Job           string    `json:"job"`
+	Target        string    `json:"target,omitempty"`
+	Source        string    `json:"source"`
+	Filename      string    `json:"filename"`
+	Error         string    `json:"error"`
+	StatusCode    int       `json:"status_code,omitempty"`
+	ResponseBody  string    `json:"response_body,omitempty"`
+	Attempts      []Attempt `json:"attempts"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// QuarantineFolder keeps files that failed permanently, each file is kept
+// in its own folder together with a json sidecar: <folder>/<id>/<filename>(.json)
+type QuarantineFolder struct {
+	folder string
+}
+
+// NewQuarantineFolder returns quarantine folder
+func NewQuarantineFolder(folder string) *QuarantineFolder {
+	return &QuarantineFolder{
+		folder: folder,
+	}
+}
+
+// Add copies the file from source into the quarantine folder and writes its sidecar
+func (q *QuarantineFolder) Add(cli Interface, job, target, sourcepath string, uploadErr *UploadError) (*QuarantineRecord, error) {
+	record := &QuarantineRecord{
+		ID:            time.Now().Format("20060102-150405.000000000"),
+		Job:           job,
+		Target:        target,
+		Source:        sourcepath,
+		Filename:      path.Base(sourcepath),
+		Attempts:      uploadErr.Attempts,
+		QuarantinedAt: time.Now(),
+	}
+	record.setError(uploadErr.Err)
+
+	errMkdir := os.MkdirAll(q.dir(record.ID), 0755)
+	if errMkdir != nil {
+		return nil, errMkdir
+	}
+
+	sourceFile, errSourceFile := cli.ReadFile(sourcepath)
+	if errSourceFile != nil {
+		return nil, errSourceFile
+	}
+	defer sourceFile.Close()
+
+	destinationFile, errCreateDestFile := os.Create(q.Path(record))
+	if errCreateDestFile != nil {
+		return nil, errCreateDestFile
+	}
+	defer destinationFile.Close()
+
+	_, errCopySourceToDest := io.Copy(destinationFile, sourceFile)
+	if errCopySourceToDest != nil {
+		return nil, errCopySourceToDest
+	}
+
+	return record, q.Save(record)
+}
+
+// List returns quarantined files ordered by quarantine time
+func (q *QuarantineFolder) List() ([]*QuarantineRecord, error) {
+	entries, err := ioutil.ReadDir(q.folder)
+	if os.IsNotExist(err) {
+		return []*QuarantineRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*QuarantineRecord, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		record, errRecord := q.Get(entry.Name())
+		if errRecord != nil {
+			Logf("Failed to read quarantine id=%s error=%s\n", entry.Name(), errRecord.Error())
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].QuarantinedAt.Before(records[j].QuarantinedAt)
+	})
+
+	return records, nil
+}
+
+// Get returns a quarantined file by its id
+func (q *QuarantineFolder) Get(id string) (*QuarantineRecord, error) {
+	sidecars, err := filepath.Glob(filepath.Join(q.dir(id), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	// The sidecar is the json file which has a quarantined file next to it
+	sidecar := ""
+	for _, item := range sidecars {
+		if _, errStat := os.Stat(strings.TrimSuffix(item, ".json")); errStat == nil {
+			sidecar = item
+			break
+		}
+	}
+	if sidecar == "" {
+		return nil, fmt.Errorf("quarantine id=%s is not found", id)
+	}
+
+	data, err := ioutil.ReadFile(sidecar)
+	if err != nil {
+		return nil, err
+	}
+
+	var record QuarantineRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Save writes the sidecar of a quarantined file
+func (q *QuarantineFolder) Save(record *QuarantineRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(q.Path(record)+".json", data, 0644)
+}
+
+// Retry updates the sidecar with the attempts of a failed retry
+func (q *QuarantineFolder) Retry(record *QuarantineRecord, uploadErr *UploadError) error {
+	offset := len(record.Attempts)
+	for _, attempt := range uploadErr.Attempts {
+		attempt.Number = attempt.Number + offset
+		record.Attempts = append(record.Attempts, attempt)
+	}
+	record.setError(uploadErr.Err)
+
+	return q.Save(record)
+}
+
+// Remove deletes a quarantined file and its sidecar
+func (q *QuarantineFolder) Remove(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return fmt.Errorf("invalid quarantine id=%s", id)
+	}
+
+	return os.RemoveAll(q.dir(id))
+}
+
+// Path returns the path of a quarantined file
+func (q *QuarantineFolder) Path(record *QuarantineRecord) string {
+	return filepath.Join(q.dir(record.ID), record.Filename)
+}
+
+func (q *QuarantineFolder) dir(id string) string {
+	return filepath.Join(q.folder, id)
+}
+
+func (r *QuarantineRecord) setError(err error) {
+	r.Error = err.Error()
+	r.StatusCode = 0
+	r.ResponseBody = ""
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		r.StatusCode = statusErr.StatusCode
+		r.ResponseBody = statusErr.Body
+	}
+}
+
+// QuarantineUsage is printed when the quarantine command is not valid
+const QuarantineUsage = "usage: kintoun quarantine list|retry|purge [id ...] [-config config.yaml] [-config-type yaml]"
+
+// QuarantineArgs are the arguments of the quarantine command
+type QuarantineArgs struct {
+	Action     string
+	IDs        []string
+	ConfigFile string
+	ConfigType string
+}
+
+// ParseQuarantineArgs parses the arguments after `kintoun quarantine`,
+// flags can be given before, between or after the ids
+func ParseQuarantineArgs(args []string) (*QuarantineArgs, error) {
+	parsed := &QuarantineArgs{}
+
+	flags := flag.NewFlagSet("quarantine", flag.ContinueOnError)
+	flags.StringVar(&parsed.ConfigFile, "config", "config.yaml", "Configuration file path")
+	flags.StringVar(&parsed.ConfigType, "config-type", "yaml", "Configuration type: yaml, yaml-base64, env")
+	flags.SetOutput(ioutil.Discard)
+
+	positional := make([]string, 0)
+	for {
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(positional) == 0 {
+		return nil, errors.New("quarantine action is required")
+	}
+
+	parsed.Action = positional[0]
+	parsed.IDs = positional[1:]
+
+	switch parsed.Action {
+	case `list`, `retry`, `purge`:
+		break
+	default:
+		return nil, fmt.Errorf("unknown quarantine command %s, use list, retry or purge", parsed.Action)
+	}
+
+	return parsed, nil
+}
+
+// RunQuarantineCommand runs `kintoun quarantine list|retry|purge [id ...]`,
+// retry and purge apply to every quarantined file when no id is given
+func RunQuarantineCommand(config *Config, action string, ids []string) error {
+	if config.Quarantine.Folder == "" {
+		return errors.New("quarantine.folder is not set")
+	}
+
+	quarantine := NewQuarantineFolder(config.Quarantine.Folder)
+
+	records, err := quarantine.List()
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		selected := make([]*QuarantineRecord, 0)
+		for _, id := range ids {
+			record, errRecord := quarantine.Get(id)
+			if errRecord != nil {
+				return errRecord
+			}
+			selected = append(selected, record)
+		}
+		records = selected
+	}
+
+	switch action {
+	case `list`:
+		for _, record := range records {
+			fmt.Printf("%s\tjob=%s\ttarget=%s\tfile=%s\tattempts=%d\tstatus_code=%d\terror=%s\n", record.ID, record.Job, record.Target, record.Source, len(record.Attempts), record.StatusCode, record.Error)
+		}
+		Logf("%d file(s) in quarantine\n", len(records))
+	case `retry`:
+		task := NewTask(config)
+		for _, record := range records {
+			uploader := task.Uploader(record.Job, record.Target)
+			if uploader == nil {
+				return fmt.Errorf("quarantine id=%s target=%s of job=%s is not found", record.ID, record.Target, record.Job)
+			}
+
+			crondata := Cron{Name: record.Job}
+			for _, item := range config.Cron {
+				if item.Name == record.Job {
+					crondata = item
+					break
+				}
+			}
+
+			cli := NewLocalFolder(filepath.Dir(quarantine.Path(record)))
+			errUpload := task.Upload(cli, uploader, crondata, NewRunID(), quarantine.Path(record))
+
+			var uploadErr *UploadError
+			if errors.As(errUpload, &uploadErr) {
+				errRetry := quarantine.Retry(record, uploadErr)
+				if errRetry != nil {
+					return errRetry
+				}
+				continue
+			}
+			if errUpload != nil {
+				return errUpload
+			}
+
+			errRemove := quarantine.Remove(record.ID)
+			if errRemove != nil {
+				return errRemove
+			}
+			Logf("Quarantine id=%s has been uploaded and removed\n", record.ID)
+		}
+	case `purge`:
+		for _, record := range records {
+			errRemove := quarantine.Remove(record.ID)
+			if errRemove != nil {
+				return errRemove
+			}
+		}
+		Logf("%d file(s) have been purged from quarantine\n", len(records))
+	default:
+		return fmt.Errorf("unknown quarantine command %s, use list, retry or purge", action)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuarantineArgs(t *testing.T) {
+	args, err := ParseQuarantineArgs([]string{"retry", "id-1", "-config", "kintoun.yaml", "id-2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "retry", args.Action)
+	assert.Equal(t, []string{"id-1", "id-2"}, args.IDs)
+	assert.Equal(t, "kintoun.yaml", args.ConfigFile)
+	assert.Equal(t, "yaml", args.ConfigType)
+
+	args, err = ParseQuarantineArgs([]string{"-config-type", "env", "list"})
+	assert.Nil(t, err)
+	assert.Equal(t, "list", args.Action)
+	assert.Empty(t, args.IDs)
+	assert.Equal(t, "env", args.ConfigType)
+
+	_, err = ParseQuarantineArgs([]string{})
+	assert.NotNil(t, err)
+
+	_, err = ParseQuarantineArgs([]string{"delete", "id-1"})
+	assert.NotNil(t, err)
+}
+
+func TestRunQuarantineCommand(t *testing.T) {
+	sourceFolder, err := ioutil.TempDir("", "kintoun-source")
+	assert.Nil(t, err)
+	defer os.RemoveAll(sourceFolder)
+
+	quarantineFolder, err := ioutil.TempDir("", "kintoun-quarantine")
+	assert.Nil(t, err)
+	defer os.RemoveAll(quarantineFolder)
+
+	status := http.StatusBadRequest
+	uploaded := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, errFile := r.FormFile("file")
+		if errFile == nil && status == http.StatusOK {
+			uploaded = append(uploaded, header.Filename)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Target: Target{
+			Host:   server.URL,
+			Upload: []map[string]string{{"key": "file", "value": "file"}},
+			Retry:  Retry{MaxAttempts: 1},
+		},
+		Cron:       []Cron{{Name: "statements"}},
+		Quarantine: Quarantine{Folder: quarantineFolder},
+	}
+
+	quarantine := NewQuarantineFolder(quarantineFolder)
+	cli := NewLocalFolder(sourceFolder)
+	ids := make([]string, 0)
+	for _, name := range []string{"a.csv", "b.csv"} {
+		filepath := filepath.Join(sourceFolder, name)
+		assert.Nil(t, ioutil.WriteFile(filepath, []byte("id,amount\n"), 0644))
+
+		record, errAdd := quarantine.Add(cli, "statements", "target-1", filepath, &UploadError{Err: errors.New("failed")})
+		assert.Nil(t, errAdd)
+		ids = append(ids, record.ID)
+	}
+
+	assert.Nil(t, RunQuarantineCommand(config, "list", nil))
+
+	assert.Nil(t, RunQuarantineCommand(config, "retry", ids[:1]))
+	record, err := quarantine.Get(ids[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(record.Attempts))
+	assert.Equal(t, http.StatusBadRequest, record.StatusCode)
+
+	status = http.StatusOK
+	assert.Nil(t, RunQuarantineCommand(config, "retry", ids[:1]))
+	assert.Equal(t, []string{"a.csv"}, uploaded)
+	_, err = quarantine.Get(ids[0])
+	assert.NotNil(t, err)
+
+	assert.Nil(t, RunQuarantineCommand(config, "purge", ids[1:]))
+	records, err := quarantine.List()
+	assert.Nil(t, err)
+	assert.Empty(t, records)
+
+	assert.NotNil(t, RunQuarantineCommand(config, "retry", ids[1:]))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Default retry policy, used when target.retry is not set
+const (
+	DefaultRetryMaxAttempts     = 5
+	DefaultRetryInitialInterval = 5
+	DefaultRetryMaxInterval     = 300
+	DefaultRetryJitter          = 0.2
+)
+
+// DefaultRetryStatus is the list of status codes retried by default
+var DefaultRetryStatus = []int{408, 425, 429, 500, 502, 503, 504}
+
+// DefaultRetryErrors is the list of error classes retried by default
+var DefaultRetryErrors = []string{`timeout`, `connection`, `dns`}
+
+// StatusError is returned when the target responds with an unexpected status code
+// or a response which does not match target.success
+type StatusError struct {
+	StatusCode int
+	Body       string
+	Reason     string
+}
+
+func (e *StatusError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("%s status_code=%d", e.Reason, e.StatusCode)
+	}
+
+	return fmt.Sprintf("unexpected status_code=%d", e.StatusCode)
+}
+
+// Attempt records a single upload attempt
+type Attempt struct {
+	Number     int       `json:"number"`
+	StartedAt  time.Time `json:"started_at"`
+	Duration   string    `json:"duration"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// NewAttempt returns the record of an upload attempt
+func NewAttempt(number int, startedAt time.Time, err error) Attempt {
+	attempt := Attempt{
+		Number:    number,
+		StartedAt: startedAt,
+		Duration:  time.Since(startedAt).Round(time.Millisecond).String(),
+	}
+
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		attempt.StatusCode = statusErr.StatusCode
+	}
+
+	return attempt
+}
+
+// UploadError is returned when a file is not uploaded after all attempts
+type UploadError struct {
+	Attempts []Attempt
+	Err      error
+}
+
+func (e *UploadError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the last attempt
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// RetryPolicy decides whether a failed upload is retried and how long to wait before it
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Jitter          float64
+	Status          map[int]bool
+	Errors          map[string]bool
+}
+
+// NewRetryPolicy returns a retry policy from target.retry, unset fields use the default policy
+func NewRetryPolicy(retry Retry) *RetryPolicy {
+	policy := &RetryPolicy{
+		MaxAttempts:     retry.MaxAttempts,
+		InitialInterval: time.Duration(retry.InitialInterval) * time.Second,
+		MaxInterval:     time.Duration(retry.MaxInterval) * time.Second,
+		Jitter:          DefaultRetryJitter,
+		Status:          make(map[int]bool),
+		Errors:          make(map[string]bool),
+	}
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if policy.InitialInterval <= 0 {
+		policy.InitialInterval = DefaultRetryInitialInterval * time.Second
+	}
+	if policy.MaxInterval <= 0 {
+		policy.MaxInterval = DefaultRetryMaxInterval * time.Second
+	}
+	if retry.Jitter != nil && *retry.Jitter >= 0 {
+		policy.Jitter = *retry.Jitter
+	}
+
+	status := retry.Status
+	if len(status) == 0 {
+		status = DefaultRetryStatus
+	}
+	for _, code := range status {
+		policy.Status[code] = true
+	}
+
+	errorClasses := retry.Errors
+	if len(errorClasses) == 0 {
+		errorClasses = DefaultRetryErrors
+	}
+	for _, class := range errorClasses {
+		policy.Errors[class] = true
+	}
+
+	return policy
+}
+
+// ShouldRetry returns true when the attempt failed with a retryable error and attempts are left
+func (p *RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	if err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return p.Status[statusErr.StatusCode]
+	}
+
+	return p.Errors[ErrorClass(err)]
+}
+
+// Backoff returns the wait before the next attempt, it grows exponentially
+// from the initial interval up to the max interval with a random jitter
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	wait := float64(p.InitialInterval) * math.Pow(2, float64(attempt-1))
+	if wait > float64(p.MaxInterval) {
+		wait = float64(p.MaxInterval)
+	}
+
+	wait = wait + wait*p.Jitter*(2*rand.Float64()-1)
+
+	return time.Duration(wait)
+}
+
+// ErrorClass classifies an upload error as timeout, dns, tls, connection or other
+func ErrorClass(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return `timeout`
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return `dns`
+	}
+
+	var certErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &certErr) || errors.As(err, &hostnameErr) || errors.As(err, &recordErr) {
+		return `tls`
+	}
+
+	var opErr *net.OpError
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &opErr) {
+		return `connection`
+	}
+
+	return `other`
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := NewRetryPolicy(Retry{MaxAttempts: 3, Status: []int{503}})
+
+	assert.True(t, policy.ShouldRetry(1, &StatusError{StatusCode: 503}))
+	assert.False(t, policy.ShouldRetry(1, &StatusError{StatusCode: 400}))
+	assert.False(t, policy.ShouldRetry(3, &StatusError{StatusCode: 503}))
+	assert.True(t, policy.ShouldRetry(1, &net.DNSError{Err: "no such host", Name: "example"}))
+	assert.False(t, policy.ShouldRetry(1, errors.New("file does not exist")))
+	assert.False(t, policy.ShouldRetry(1, nil))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	jitter := 0.5
+	policy := NewRetryPolicy(Retry{InitialInterval: 2, MaxInterval: 10, Jitter: &jitter})
+
+	for i := 0; i < 20; i++ {
+		wait := policy.Backoff(1)
+		assert.True(t, wait >= 1*time.Second && wait <= 3*time.Second)
+
+		wait = policy.Backoff(3)
+		assert.True(t, wait >= 4*time.Second && wait <= 12*time.Second)
+
+		wait = policy.Backoff(10)
+		assert.True(t, wait >= 5*time.Second && wait <= 15*time.Second)
+	}
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	assert.Equal(t, DefaultRetryJitter, NewRetryPolicy(Retry{}).Jitter)
+
+	// A jitter of 0 in the config file is kept, the backoff is not randomized
+	var retry Retry
+	assert.Nil(t, yaml.Unmarshal([]byte("initial_interval: 2\njitter: 0\n"), &retry))
+
+	policy := NewRetryPolicy(retry)
+	assert.Equal(t, float64(0), policy.Jitter)
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, 2*time.Second, policy.Backoff(1))
+	}
+
+	retry = Retry{}
+	assert.Nil(t, yaml.Unmarshal([]byte("initial_interval: 2\n"), &retry))
+	assert.Equal(t, DefaultRetryJitter, NewRetryPolicy(retry).Jitter)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+)
+
+// DefaultRouteBytes is the number of bytes read from a file when route.bytes is not set
+const DefaultRouteBytes = 512
+
+// Route returns the uploaders a file is sent to. The first route which matches the file
+// decides its target, files which match no route are sent to every target of the job
+func (t *Task) Route(cli Interface, crondata Cron, filepath string) ([]*Uploader, bool, error) {
+	if len(crondata.Routes) == 0 {
+		return t.uploaders[crondata.Name], false, nil
+	}
+
+	isSizeRoute := false
+	var headBytes int64
+	for _, route := range crondata.Routes {
+		if route.MinSize > 0 || route.MaxSize > 0 {
+			isSizeRoute = true
+		}
+		if route.Content != "" || route.Header != "" {
+			headBytes = maxInt64(headBytes, routeBytes(route))
+		}
+	}
+
+	size := int64(-1)
+	if isSizeRoute {
+		size = t.routeSize(cli, crondata, filepath)
+	}
+
+	var head []byte
+	if headBytes > 0 {
+		var errHead error
+		head, errHead = readHead(cli, filepath, headBytes)
+		if errHead != nil {
+			return nil, false, errHead
+		}
+	}
+
+	for index, route := range crondata.Routes {
+		isMatch, errMatch := matchRoute(route, path.Base(filepath), size, head)
+		if errMatch != nil {
+			return nil, false, fmt.Errorf("route=%d %s", index+1, errMatch.Error())
+		}
+		if !isMatch {
+			continue
+		}
+
+		if route.Drop {
+			Logf("File=%s is dropped by route=%d\n", filepath, index+1)
+			return nil, true, nil
+		}
+
+		uploader := t.Uploader(crondata.Name, route.Target)
+		if uploader == nil {
+			return nil, false, fmt.Errorf("route=%d target=%s is not found", index+1, route.Target)
+		}
+
+		Logf("File=%s is routed to target=%s by route=%d\n", filepath, route.Target, index+1)
+		return []*Uploader{uploader}, false, nil
+	}
+
+	return t.uploaders[crondata.Name], false, nil
+}
+
+func (t *Task) routeSize(cli Interface, crondata Cron, filepath string) int64 {
+	stater, ok := cli.(Stater)
+	if !ok {
+		Logf("Source type=%s does not support file size, size routes are skipped\n", t.config.JobSource(crondata).Type)
+		return -1
+	}
+
+	info, errStat := stater.Stat(filepath)
+	if errStat != nil {
+		Logf("Failed to stat file=%s error=%s\n", filepath, errStat.Error())
+		return -1
+	}
+
+	return info.Size()
+}
+
+// matchRoute checks a file against the conditions of a route. size is -1 when it is unknown,
+// head is the beginning of the file and it is only read when a route matches on content
+func matchRoute(route Route, filename string, size int64, head []byte) (bool, error) {
+	if route.Match != "" {
+		pattern, errPattern := regexp.Compile(route.Match)
+		if errPattern != nil {
+			return false, errPattern
+		}
+
+		matches := pattern.FindStringSubmatch(filename)
+		if matches == nil {
+			return false, nil
+		}
+
+		if route.Group != "" {
+			index := routeGroupIndex(pattern, route.Group)
+			if index < 0 || index >= len(matches) {
+				return false, fmt.Errorf("group=%s is not found in match=%s", route.Group, route.Match)
+			}
+			if matches[index] != route.Value {
+				return false, nil
+			}
+		}
+	}
+
+	if route.MinSize > 0 && (size < 0 || size < route.MinSize) {
+		return false, nil
+	}
+	if route.MaxSize > 0 && (size < 0 || size > route.MaxSize) {
+		return false, nil
+	}
+
+	if route.Content != "" {
+		isMatch, errContent := regexp.Match(route.Content, head)
+		if errContent != nil || !isMatch {
+			return false, errContent
+		}
+	}
+
+	if route.Header != "" {
+		header := head
+		if index := bytes.IndexByte(header, '\n'); index >= 0 {
+			header = header[:index]
+		}
+		header = bytes.TrimSuffix(bytes.TrimPrefix(header, []byte("\xef\xbb\xbf")), []byte("\r"))
+
+		isMatch, errHeader := regexp.Match(route.Header, header)
+		if errHeader != nil || !isMatch {
+			return false, errHeader
+		}
+	}
+
+	return true, nil
+}
+
+// routeGroupIndex returns the index of a named or numbered group of a pattern
+func routeGroupIndex(pattern *regexp.Regexp, group string) int {
+	for index, name := range pattern.SubexpNames() {
+		if index > 0 && name == group {
+			return index
+		}
+	}
+
+	index, errIndex := strconv.Atoi(group)
+	if errIndex != nil {
+		return -1
+	}
+
+	return index
+}
+
+func routeBytes(route Route) int64 {
+	if route.Bytes > 0 {
+		return route.Bytes
+	}
+
+	return DefaultRouteBytes
+}
+
+// readHead reads up to n bytes from the beginning of a source file
+func readHead(cli Interface, filepath string, n int64) ([]byte, error) {
+	sourceFile, errSourceFile := cli.ReadFile(filepath)
+	if errSourceFile != nil {
+		return nil, errSourceFile
+	}
+	defer sourceFile.Close()
+
+	return ioutil.ReadAll(io.LimitReader(sourceFile, n))
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRoute(t *testing.T) {
+	route := Route{Match: `^\d+_(?P<kind>[A-Z]+)_`, Group: "kind", Value: "WITHDRAWAL"}
+
+	isMatch, err := matchRoute(route, "20260101_WITHDRAWAL_01.csv", -1, nil)
+	assert.Nil(t, err)
+	assert.True(t, isMatch)
+
+	isMatch, err = matchRoute(route, "20260101_DEPOSIT_01.csv", -1, nil)
+	assert.Nil(t, err)
+	assert.False(t, isMatch)
+
+	route.Group = "1"
+	isMatch, _ = matchRoute(route, "20260101_WITHDRAWAL_01.csv", -1, nil)
+	assert.True(t, isMatch)
+
+	route.Group = "2"
+	_, err = matchRoute(route, "20260101_WITHDRAWAL_01.csv", -1, nil)
+	assert.NotNil(t, err)
+
+	route = Route{MinSize: 10, MaxSize: 20}
+	isMatch, _ = matchRoute(route, "a.csv", 15, nil)
+	assert.True(t, isMatch)
+	isMatch, _ = matchRoute(route, "a.csv", 25, nil)
+	assert.False(t, isMatch)
+	isMatch, _ = matchRoute(route, "a.csv", -1, nil)
+	assert.False(t, isMatch)
+
+	route = Route{Header: `^id,amount,currency$`}
+	isMatch, _ = matchRoute(route, "a.csv", -1, []byte("\xef\xbb\xbfid,amount,currency\r\n1,10,IDR\r\n"))
+	assert.True(t, isMatch)
+
+	route = Route{Content: `IDR`}
+	isMatch, _ = matchRoute(route, "a.csv", -1, []byte("id,amount,currency\n1,10,USD\n"))
+	assert.False(t, isMatch)
+}
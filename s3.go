@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3ListPageSize is the maximum number of keys requested per list page
+const S3ListPageSize = 1000
+
+// S3 client for S3-compatible object storage
+type S3 struct {
+	s3client           *minio.Client
+	bucket             string
+	filenameToDownload []string
+}
+
+// NewS3 initiates S3-compatible object storage client
+// username and password are used as access key id and secret access key
+// The bucket is checked once so an unreachable host fails within timeout
+func NewS3(host, port, username, password, bucket, region string, useSSL bool, timeout time.Duration) (Interface, error) {
+	endpoint := host
+	if port != "" {
+		endpoint = fmt.Sprintf("%s:%s", host, port)
+	}
+
+	s3client, errS3Client := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(username, password, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if errS3Client != nil {
+		return nil, errS3Client
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	isExists, errBucket := s3client.BucketExists(ctx, bucket)
+	if errBucket != nil {
+		return nil, errBucket
+	}
+	if !isExists {
+		return nil, fmt.Errorf("bucket=%s does not exist", bucket)
+	}
+
+	return &S3{
+		s3client: s3client,
+		bucket:   bucket,
+	}, nil
+}
+
+// ReaddirSourceFolder is used to list objects under a bucket prefix
+// Listing is paginated, each page requests up to S3ListPageSize keys
+func (s *S3) ReaddirSourceFolder(crondata Cron) error {
+	fileToDownload := make([]string, 0)
+
+	if crondata.Task.FilePrefix != "" {
+		prefix := strings.TrimPrefix(crondata.Task.SourceFolder, "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix = prefix + "/"
+		}
+
+		objects := s.s3client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+			Prefix:  prefix,
+			MaxKeys: S3ListPageSize,
+		})
+
+		for item := range objects {
+			if item.Err != nil {
+				return item.Err
+			}
+
+			if strings.HasSuffix(item.Key, "/") {
+				continue
+			}
+
+			filename := path.Base(item.Key)
+			if isFileToDownload(crondata, filename, item.LastModified) {
+				fileToDownload = append(fileToDownload, filename)
+			}
+		}
+	} else {
+		fileToDownload = append(fileToDownload, crondata.Task.File)
+	}
+
+	s.SetFilenameToDownload(fileToDownload)
+
+	return nil
+}
+
+// SetFilenameToDownload is used to set a filename to download as temp file
+func (s *S3) SetFilenameToDownload(filename []string) {
+	s.filenameToDownload = filename
+}
+
+// GetFilenameToDownload is used to get a filename to download as temp file
+func (s *S3) GetFilenameToDownload() []string {
+	return s.filenameToDownload
+}
+
+// ReadFile opens the object for a streaming read
+func (s *S3) ReadFile(filepath string) (io.ReadCloser, error) {
+	Logf("Reading file=%s ...\n", filepath)
+
+	sourceFile, errSourceFile := s.s3client.GetObject(context.Background(), s.bucket, strings.TrimPrefix(filepath, "/"), minio.GetObjectOptions{})
+	if errSourceFile != nil {
+		return nil, errSourceFile
+	}
+
+	return sourceFile, nil
+}
+
+// Stat returns the size and modified time of an object
+func (s *S3) Stat(filepath string) (os.FileInfo, error) {
+	object, errStat := s.s3client.StatObject(context.Background(), s.bucket, strings.TrimPrefix(filepath, "/"), minio.StatObjectOptions{})
+	if errStat != nil {
+		return nil, errStat
+	}
+
+	return &fileInfo{name: path.Base(object.Key), size: object.Size, modTime: object.LastModified}, nil
+}
+
+// Close for S3 is do nothing, requests are stateless
+func (s *S3) Close() {}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleParser parses standard 5 field cron expressions, an optional seconds field
+// in front of them and descriptors such as @hourly or @every 1h30m
+var scheduleParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// jobSchedule returns the schedule of a job in its time zone. cron.schedule is used when it is set, otherwise
+// every, type, at and specific_day are mapped onto a schedule. start is the time the job is registered
+func jobSchedule(crondata Cron, start time.Time) (cron.Schedule, error) {
+	location := jobLocation(crondata)
+	if crondata.Schedule != "" {
+		return parseSchedule(crondata.Schedule, location)
+	}
+
+	every := crondata.Every
+	if every == 0 {
+		every = 1
+	}
+
+	hour, minute := 0, 0
+	if crondata.At != "" {
+		at, errAt := time.Parse("15:04", crondata.At)
+		if errAt != nil {
+			return nil, fmt.Errorf("at=%s must be formatted as HH:MM", crondata.At)
+		}
+		hour, minute = at.Hour(), at.Minute()
+	}
+
+	if crondata.SpecificDay != "" && !strings.EqualFold(crondata.SpecificDay, "none") {
+		weekday, ok := parseWeekday(crondata.SpecificDay)
+		if !ok {
+			return nil, fmt.Errorf("specific_day=%s is not a day of the week", crondata.SpecificDay)
+		}
+
+		return parseSchedule(fmt.Sprintf("%d %d * * %d", minute, hour, weekday), location)
+	}
+
+	switch strings.TrimSuffix(strings.ToLower(crondata.Type), "s") {
+	case "second":
+		return cron.Every(time.Duration(every) * time.Second), nil
+	case "minute":
+		return cron.Every(time.Duration(every) * time.Minute), nil
+	case "hour":
+		return cron.Every(time.Duration(every) * time.Hour), nil
+	}
+
+	return &daySchedule{every: int(every), hour: hour, minute: minute, start: start.In(location), location: location}, nil
+}
+
+// parseSchedule parses a cron expression in a time zone unless the expression sets CRON_TZ
+func parseSchedule(spec string, location *time.Location) (cron.Schedule, error) {
+	if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=" + location.String() + " " + spec
+	}
+
+	return scheduleParser.Parse(spec)
+}
+
+// LoadTimezones loads the time zone of every job, jobs without timezone use timezone
+func (c *Config) LoadTimezones() error {
+	for index := range c.Cron {
+		crondata := &c.Cron[index]
+		if crondata.Timezone == "" {
+			crondata.Timezone = c.Timezone
+		}
+		if crondata.Timezone == "" {
+			continue
+		}
+
+		location, errLocation := time.LoadLocation(crondata.Timezone)
+		if errLocation != nil {
+			return fmt.Errorf("job=%s timezone=%s error=%s", crondata.Name, crondata.Timezone, errLocation.Error())
+		}
+		Locations[crondata.Timezone] = location
+	}
+
+	return nil
+}
+
+// jobLocation returns the time zone of a job, the local time zone is used when it is not set
+func jobLocation(crondata Cron) *time.Location {
+	if crondata.Timezone == "" {
+		return time.Local
+	}
+
+	if location, ok := Locations[crondata.Timezone]; ok {
+		return location
+	}
+
+	location, errLocation := time.LoadLocation(crondata.Timezone)
+	if errLocation != nil {
+		return time.Local
+	}
+
+	return location
+}
+
+// daySchedule runs every N days at a time of the day, counted from the day the job is registered.
+// On a day where the time does not exist because of DST, the job runs after the clock moved forward
+type daySchedule struct {
+	every    int
+	hour     int
+	minute   int
+	start    time.Time
+	location *time.Location
+}
+
+// Next returns the next time the job runs after t
+func (s *daySchedule) Next(t time.Time) time.Time {
+	next := s.at(t)
+	if !next.After(t) {
+		next = s.at(t.In(s.location).AddDate(0, 0, 1))
+	}
+
+	first := s.at(s.start)
+	if first.Before(s.start) {
+		first = s.at(s.start.AddDate(0, 0, 1))
+	}
+
+	if rem := daysBetween(first, next) % s.every; rem != 0 {
+		next = s.at(next.AddDate(0, 0, s.every-rem))
+	}
+
+	return next
+}
+
+func (s *daySchedule) at(t time.Time) time.Time {
+	t = t.In(s.location)
+	at := time.Date(t.Year(), t.Month(), t.Day(), s.hour, s.minute, 0, 0, s.location)
+	if at.Hour() != s.hour || at.Minute() != s.minute {
+		// The time is skipped by DST, it is moved forward by the DST gap
+		_, offsetBefore := at.Zone()
+		_, offsetAfter := at.Add(24 * time.Hour).Zone()
+		at = at.Add(time.Duration(offsetAfter-offsetBefore) * time.Second)
+	}
+
+	return at
+}
+
+// daysBetween counts calendar days, days which are shorter or longer because of DST count as one
+func daysBetween(from, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+func parseWeekday(day string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := weekday.String()
+		if strings.EqualFold(day, name) || strings.EqualFold(day, name[:3]) {
+			return weekday, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobSchedule(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+
+	schedule, err := jobSchedule(Cron{Timezone: "UTC", Schedule: "30 9 * * 1-5"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 3, 9, 30, 0, 0, time.UTC), schedule.Next(start))
+
+	schedule, err = jobSchedule(Cron{Timezone: "UTC", Schedule: "@hourly"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC), schedule.Next(start))
+
+	schedule, err = jobSchedule(Cron{Timezone: "UTC", Every: 15, Type: "minutes"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 2, 10, 15, 0, 0, time.UTC), schedule.Next(start))
+
+	schedule, err = jobSchedule(Cron{Timezone: "UTC", Every: 1, Type: "day", SpecificDay: "friday", At: "07:45"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 6, 7, 45, 0, 0, time.UTC), schedule.Next(start))
+
+	schedule, err = jobSchedule(Cron{Timezone: "UTC", Every: 3, Type: "days", At: "11:00"}, start)
+	assert.Nil(t, err)
+	next := schedule.Next(start)
+	assert.Equal(t, time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC), next)
+	assert.Equal(t, time.Date(2026, 3, 5, 11, 0, 0, 0, time.UTC), schedule.Next(next))
+
+	schedule, err = jobSchedule(Cron{Timezone: "UTC", Every: 1, Type: "day", SpecificDay: "None"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC), schedule.Next(start))
+
+	_, err = jobSchedule(Cron{Timezone: "UTC", Schedule: "61 * * * *"}, start)
+	assert.NotNil(t, err)
+
+	_, err = jobSchedule(Cron{Timezone: "UTC", SpecificDay: "someday"}, start)
+	assert.NotNil(t, err)
+
+	_, err = jobSchedule(Cron{Timezone: "UTC", At: "7am"}, start)
+	assert.NotNil(t, err)
+}
+
+func TestJobScheduleTimezone(t *testing.T) {
+	start := time.Date(2026, 3, 7, 15, 0, 0, 0, time.UTC)
+
+	schedule, err := jobSchedule(Cron{Timezone: "Asia/Jakarta", Every: 1, Type: "day", At: "07:00"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 8, 0, 0, 0, 0, time.UTC), schedule.Next(start).UTC())
+
+	schedule, err = jobSchedule(Cron{Timezone: "Asia/Singapore", Schedule: "0 7 * * *"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 7, 23, 0, 0, 0, time.UTC), schedule.Next(start).UTC())
+
+	// New York moves to daylight saving time on 2026-03-08
+	schedule, err = jobSchedule(Cron{Timezone: "America/New_York", Every: 1, Type: "day", At: "09:00"}, start)
+	assert.Nil(t, err)
+	next := schedule.Next(start)
+	assert.Equal(t, time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC), next.UTC())
+	assert.Equal(t, time.Date(2026, 3, 9, 13, 0, 0, 0, time.UTC), schedule.Next(next).UTC())
+
+	schedule, err = jobSchedule(Cron{Timezone: "America/New_York", Every: 1, Type: "day", At: "02:30"}, start)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC), schedule.Next(start).UTC())
+
+	config := &Config{Timezone: "Asia/Jakarta", Cron: []Cron{{Name: "a"}, {Name: "b", Timezone: "UTC"}}}
+	assert.Nil(t, config.LoadTimezones())
+	assert.Equal(t, "Asia/Jakarta", config.Cron[0].Timezone)
+	assert.Equal(t, "UTC", config.Cron[1].Timezone)
+
+	config.Cron[1].Timezone = "Mars/Olympus"
+	assert.NotNil(t, config.LoadTimezones())
+}
@@ -5,8 +5,6 @@ import (
 	"io"
 	"net"
 	"os"
-	"regexp"
-	"strings"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -17,14 +15,13 @@ import (
 type SFTP struct {
 	sftpclient         *sftp.Client
 	filenameToDownload []string
-	lastFileModTime    map[string]time.Time
-	lastFileUpload     map[string]string
 }
 
 // NewSFTP initiates SFTP client
-func NewSFTP(host, port, username, password string) Interface {
+func NewSFTP(host, port, username, password string, timeout time.Duration) (Interface, error) {
 	sshconfig := &ssh.ClientConfig{
-		User: username,
+		User:    username,
+		Timeout: timeout,
 		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
 			return nil
 		},
@@ -37,19 +34,18 @@ func NewSFTP(host, port, username, password string) Interface {
 
 	sshclient, errSSHClient := ssh.Dial("tcp", hostAddr, sshconfig)
 	if errSSHClient != nil {
-		panic(errSSHClient)
+		return nil, errSSHClient
 	}
 
 	sftpclient, errSftpClient := sftp.NewClient(sshclient)
 	if errSftpClient != nil {
-		panic(errSftpClient)
+		sshclient.Close()
+		return nil, errSftpClient
 	}
 
 	return &SFTP{
-		sftpclient:      sftpclient,
-		lastFileModTime: LastFileModTime,
-		lastFileUpload:  LastFileUpload,
-	}
+		sftpclient: sftpclient,
+	}, nil
 }
 
 // ReaddirSourceFolder is used to read files in a dir
@@ -59,27 +55,11 @@ func (s *SFTP) ReaddirSourceFolder(crondata Cron) error {
 	if crondata.Task.FilePrefix != "" {
 		sourceFiles, errSourceFiles := s.sftpclient.ReadDir(crondata.Task.SourceFolder)
 		if errSourceFiles != nil {
-			Logf("Failed to list directory dir=%s error=%s\n", crondata.Task.SourceFolder, errSourceFiles.Error())
+			return errSourceFiles
 		}
 
 		for _, item := range sourceFiles {
-			isMatch, _ := regexp.MatchString(crondata.Task.FilePrefix, item.Name())
-			isYearMatch := item.ModTime().Year() == time.Now().Year()
-			isMonthMatch := item.ModTime().Month() == time.Now().Month()
-			isDayMatch := item.ModTime().Day() == time.Now().Day()
-
-			prefixCodes := strings.Split(item.Name(), crondata.Task.FilePrefixDelimiter)
-			prefixCode := prefixCodes[crondata.Task.FilePrefixIndex]
-			isFileLatestUpdate := item.ModTime().After(s.lastFileModTime[prefixCode])
-			isPrevFileDifferent := s.lastFileUpload[prefixCode] != item.Name()
-
-			if !isPrevFileDifferent {
-				continue
-			}
-
-			if isMatch && isYearMatch && isMonthMatch && isDayMatch && isFileLatestUpdate && isPrevFileDifferent {
-				s.lastFileModTime[prefixCode] = item.ModTime()
-				s.lastFileUpload[prefixCode] = item.Name()
+			if isFileToDownload(crondata, item.Name(), item.ModTime()) {
 				fileToDownload = append(fileToDownload, item.Name())
 			}
 		}
@@ -102,31 +82,21 @@ func (s *SFTP) GetFilenameToDownload() []string {
 	return s.filenameToDownload
 }
 
-// DownloadTempFile will download the file
-func (s *SFTP) DownloadTempFile(filepath string) error {
-	Logf("Downloading file=%s ...\n", filepath)
+// ReadFile opens the file for a streaming read
+func (s *SFTP) ReadFile(filepath string) (io.ReadCloser, error) {
+	Logf("Reading file=%s ...\n", filepath)
 
 	sourceFile, errSourceFile := s.sftpclient.Open(filepath)
 	if errSourceFile != nil {
-		return errSourceFile
-	}
-	defer sourceFile.Close()
-
-	tempfile := fmt.Sprintf("./%s", s.GetFilenameToDownload())
-	destinationFile, errCreateDestFile := os.Create(tempfile)
-	if errCreateDestFile != nil {
-		return errCreateDestFile
+		return nil, errSourceFile
 	}
-	defer destinationFile.Close()
 
-	_, errCopySourceToDest := io.Copy(destinationFile, sourceFile)
-	if errCopySourceToDest != nil {
-		return errCopySourceToDest
-	}
-	destinationFile.Sync()
-	Log("File has been downloaded succesfully ...")
+	return sourceFile, nil
+}
 
-	return nil
+// Stat returns the size and modified time of a file
+func (s *SFTP) Stat(filepath string) (os.FileInfo, error) {
+	return s.sftpclient.Stat(filepath)
 }
 
 // Close is used to close a connection
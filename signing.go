@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSigningCanonical is the default string to sign of target.signing
+const DefaultSigningCanonical = "{{.Method}}\n{{.Path}}\n{{.Timestamp}}\n{{.BodySHA256}}"
+
+// SigningData is the data available in target.signing canonical and header templates,
+// fields of the file template data are available as well
+type SigningData struct {
+	*TemplateData
+	Method           string
+	Path             string
+	Query            string
+	Timestamp        string
+	BodySHA256       string
+	BodySHA256Base64 string
+	Signature        string
+}
+
+// sign computes the HMAC of the canonical string and sets the signature headers.
+// The body is written once into a digest before it is streamed, so the digest
+// is computed over the exact bytes that are sent
+func (u *Uploader) sign(req *http.Request, cli Interface, filepath string, writeBody func(w io.Writer, file io.Reader) error, data *TemplateData) error {
+	signing := u.target.Signing
+
+	newHash, err := signingHash(signing.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	file, err := cli.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.New()
+	counter := &countWriter{w: digest}
+	err = writeBody(counter, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	// The size is known from the digest, so the request is not sent chunked
+	req.ContentLength = counter.n
+
+	bodySum := digest.Sum(nil)
+	signingData := &SigningData{
+		TemplateData:     data,
+		Method:           req.Method,
+		Path:             req.URL.EscapedPath(),
+		Query:            req.URL.RawQuery,
+		Timestamp:        strconv.FormatInt(time.Now().Unix(), 10),
+		BodySHA256:       hex.EncodeToString(bodySum),
+		BodySHA256Base64: base64.StdEncoding.EncodeToString(bodySum),
+	}
+
+	canonical := signing.Canonical
+	if canonical == "" {
+		canonical = DefaultSigningCanonical
+	}
+	canonical, err = renderTemplate(canonical, signingData)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(newHash, []byte(signing.Key))
+	mac.Write([]byte(canonical))
+	if signing.Encoding == `base64` {
+		signingData.Signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	} else {
+		signingData.Signature = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	headers := signing.Header
+	if len(headers) == 0 {
+		headers = []map[string]string{
+			{"key": "X-Timestamp", "value": "{{.Timestamp}}"},
+			{"key": "X-Signature", "value": "{{.Signature}}"},
+		}
+	}
+
+	for _, header := range headers {
+		value, errRender := renderTemplate(header["value"], signingData)
+		if errRender != nil {
+			return errRender
+		}
+		req.Header.Set(header["key"], value)
+	}
+
+	return nil
+}
+
+// validateSigning rejects target.signing for uploads which are not a single request,
+// webdav, tus and target.steps requests are never signed
+func validateSigning(target Target) error {
+	if target.Signing.Key == "" {
+		return nil
+	}
+
+	switch strings.ToLower(target.Type) {
+	case `webdav`, `tus`:
+		return fmt.Errorf("target.signing is not supported by target type %s", target.Type)
+	}
+
+	if len(target.Steps) > 0 {
+		return errors.New("target.signing is not supported with target.steps")
+	}
+
+	_, err := signingHash(target.Signing.Algorithm)
+	return err
+}
+
+// signingHash returns the hash of target.signing.algorithm, hmac-sha256 is used by default
+func signingHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case ``, `hmac-sha256`:
+		return sha256.New, nil
+	case `hmac-sha512`:
+		return sha512.New, nil
+	case `hmac-sha1`:
+		return sha1.New, nil
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %s, use hmac-sha256, hmac-sha512 or hmac-sha1", algorithm)
+	}
+}
+
+// countWriter counts the bytes written through it
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
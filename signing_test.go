@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type signedRequest struct {
+	method    string
+	path      string
+	body      []byte
+	timestamp string
+	signature string
+	chunked   bool
+}
+
+func uploadSigned(t *testing.T, target Target) signedRequest {
+	var received signedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.Nil(t, err)
+		received = signedRequest{
+			method:    r.Method,
+			path:      r.URL.EscapedPath(),
+			body:      body,
+			timestamp: r.Header.Get("X-Timestamp"),
+			signature: r.Header.Get("X-Signature"),
+			chunked:   len(r.TransferEncoding) > 0,
+		}
+	}))
+	defer server.Close()
+
+	target.Host = server.URL + "/upload/a%20b"
+	fixture := newUploadFixture(t, "a b.csv", &Config{Target: target})
+	assert.Nil(t, fixture.Upload(""))
+
+	return received
+}
+
+func TestSigningDefaultCanonical(t *testing.T) {
+	for _, mode := range []string{"raw", "multipart"} {
+		received := uploadSigned(t, Target{
+			Mode:    mode,
+			Upload:  []map[string]string{{"key": "file", "value": "file"}},
+			Signing: Signing{Key: "s3cret"},
+		})
+		assert.Contains(t, string(received.body), "id,amount\n1,100\n", mode)
+
+		// The digest is computed over the exact bytes of the streamed body
+		bodySum := sha256.Sum256(received.body)
+		canonical := "POST\n/upload/a%20b\n" + received.timestamp + "\n" + hex.EncodeToString(bodySum[:])
+
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(canonical))
+		assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), received.signature, mode)
+		assert.NotEmpty(t, received.timestamp, mode)
+		assert.False(t, received.chunked, mode)
+	}
+}
+
+func TestSigningCanonicalEncoding(t *testing.T) {
+	received := uploadSigned(t, Target{
+		Mode:   "raw",
+		Method: "put",
+		Signing: Signing{
+			Key:       "s3cret",
+			Algorithm: "hmac-sha512",
+			Encoding:  "base64",
+			Canonical: "{{.Method}}|{{.Filename}}|{{.BodySHA256Base64}}",
+		},
+	})
+
+	bodySum := sha256.Sum256(received.body)
+	canonical := "PUT|a b.csv|" + base64.StdEncoding.EncodeToString(bodySum[:])
+
+	mac := hmac.New(sha512.New, []byte("s3cret"))
+	mac.Write([]byte(canonical))
+	assert.Equal(t, "PUT", received.method)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), received.signature)
+}
+
+func TestSigningValidation(t *testing.T) {
+	assert.Nil(t, validateSigning(Target{Type: "webdav"}))
+	assert.Nil(t, validateSigning(Target{Signing: Signing{Key: "s3cret"}}))
+	assert.NotNil(t, validateSigning(Target{Type: "webdav", Signing: Signing{Key: "s3cret"}}))
+	assert.NotNil(t, validateSigning(Target{Type: "tus", Signing: Signing{Key: "s3cret"}}))
+	assert.NotNil(t, validateSigning(Target{Steps: []Step{{}}, Signing: Signing{Key: "s3cret"}}))
+	assert.NotNil(t, validateSigning(Target{Signing: Signing{Key: "s3cret", Algorithm: "md5"}}))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// SMB client for SMB2/3 network share
+type SMB struct {
+	conn               net.Conn
+	session            *smb2.Session
+	share              *smb2.Share
+	filenameToDownload []string
+}
+
+// NewSMB initiates SMB client using NTLM authentication
+func NewSMB(host, port, username, password, domain, share string, timeout time.Duration) (Interface, error) {
+	if port == "" {
+		port = "445"
+	}
+
+	hostAddr := net.JoinHostPort(host, port)
+
+	conn, errConn := net.DialTimeout("tcp", hostAddr, timeout)
+	if errConn != nil {
+		return nil, errConn
+	}
+
+	dialer := &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{
+			User:     username,
+			Password: password,
+			Domain:   domain,
+		},
+	}
+
+	session, errSession := dialer.Dial(conn)
+	if errSession != nil {
+		conn.Close()
+		return nil, errSession
+	}
+
+	smbshare, errMount := session.Mount(share)
+	if errMount != nil {
+		session.Logoff()
+		conn.Close()
+		return nil, errMount
+	}
+
+	return &SMB{
+		conn:    conn,
+		session: session,
+		share:   smbshare,
+	}, nil
+}
+
+// ReaddirSourceFolder is used to read files in a share folder
+func (s *SMB) ReaddirSourceFolder(crondata Cron) error {
+	fileToDownload := make([]string, 0)
+
+	if crondata.Task.FilePrefix != "" {
+		sourceFiles, errSourceFiles := s.share.ReadDir(smbPath(crondata.Task.SourceFolder))
+		if errSourceFiles != nil {
+			return errSourceFiles
+		}
+
+		for _, item := range sourceFiles {
+			if item.IsDir() {
+				continue
+			}
+
+			if isFileToDownload(crondata, item.Name(), item.ModTime()) {
+				fileToDownload = append(fileToDownload, item.Name())
+			}
+		}
+	} else {
+		fileToDownload = append(fileToDownload, crondata.Task.File)
+	}
+
+	s.SetFilenameToDownload(fileToDownload)
+
+	return nil
+}
+
+// SetFilenameToDownload is used to set a filename to download as temp file
+func (s *SMB) SetFilenameToDownload(filename []string) {
+	s.filenameToDownload = filename
+}
+
+// GetFilenameToDownload is used to get a filename to download as temp file
+func (s *SMB) GetFilenameToDownload() []string {
+	return s.filenameToDownload
+}
+
+// ReadFile opens the file for a streaming read
+func (s *SMB) ReadFile(filepath string) (io.ReadCloser, error) {
+	Logf("Reading file=%s ...\n", filepath)
+
+	sourceFile, errSourceFile := s.share.Open(smbPath(filepath))
+	if errSourceFile != nil {
+		return nil, errSourceFile
+	}
+
+	return sourceFile, nil
+}
+
+// Archive moves an uploaded file into the archive folder
+func (s *SMB) Archive(filepath, archiveFolder string) error {
+	if archiveFolder == "" {
+		return nil
+	}
+
+	errMkdir := s.share.MkdirAll(smbPath(archiveFolder), 0755)
+	if errMkdir != nil {
+		return errMkdir
+	}
+
+	return s.share.Rename(smbPath(filepath), smbPath(path.Join(archiveFolder, path.Base(filepath))))
+}
+
+// Stat returns the size and modified time of a file
+func (s *SMB) Stat(filepath string) (os.FileInfo, error) {
+	return s.share.Stat(smbPath(filepath))
+}
+
+// Close is used to close a connection
+func (s *SMB) Close() {
+	s.share.Umount()
+	s.session.Logoff()
+	s.conn.Close()
+}
+
+// smbPath converts a folder path into a path relative to the share root
+func smbPath(filepath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath), "/")
+}
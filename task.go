@@ -1,97 +1,112 @@
 package main
 
 import (
-	"bytes"
-	"io"
-	"mime/multipart"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strconv"
+	"errors"
+	"fmt"
+	"log"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/jasonlvhit/gocron"
+	"github.com/robfig/cron/v3"
 )
 
 // Task represents task that will be executed
 type Task struct {
-	config *Config
+	config    *Config
+	uploaders map[string][]*Uploader
+	scheduler *cron.Cron
+	mutex     sync.Mutex
 }
 
 // NewTask returns a task object
 func NewTask(config *Config) *Task {
-	return &Task{
-		config: config,
+	task := &Task{
+		config:    config,
+		uploaders: make(map[string][]*Uploader),
+		scheduler: cron.New(),
 	}
+
+	for _, crondata := range config.Cron {
+		for index, target := range config.JobTargets(crondata) {
+			if target.Name == "" {
+				target.Name = fmt.Sprintf("target-%d", index+1)
+			}
+
+			uploader, errUploader := NewUploader(target)
+			if errUploader != nil {
+				log.Fatalf("job=%s target=%s error=%s", crondata.Name, target.Name, errUploader.Error())
+			}
+
+			task.uploaders[crondata.Name] = append(task.uploaders[crondata.Name], uploader)
+		}
+
+		for index, route := range crondata.Routes {
+			if route.Drop {
+				continue
+			}
+			if route.Target == "" || task.Uploader(crondata.Name, route.Target) == nil {
+				log.Fatalf("job=%s route=%d error=target=%s is not found", crondata.Name, index+1, route.Target)
+			}
+		}
+	}
+
+	return task
+}
+
+// Uploader returns the uploader of a job target, the first target is used when name is empty
+func (t *Task) Uploader(job, name string) *Uploader {
+	for _, uploader := range t.uploaders[job] {
+		if name == "" || uploader.target.Name == name {
+			return uploader
+		}
+	}
+
+	return nil
 }
 
 // Start will start running the job in background
 func (t *Task) Start() {
 	t.Register()
+	t.scheduler.Start()
 
-	_, time := gocron.NextRun()
-	Log("Service started at " + time.String())
+	var next time.Time
+	for _, entry := range t.scheduler.Entries() {
+		if next.IsZero() || entry.Next.Before(next) {
+			next = entry.Next
+		}
+	}
+	Log("Service started, next run at " + next.String())
 	Log("----------------------------------")
 
-	<-gocron.Start()
+	select {}
 }
 
-// Register is used to register new cron task
+// Register is used to register new cron task. Jobs run one at a time,
+// a run is skipped when the previous run of the same job is still running
 func (t *Task) Register() {
 	Log("Register job started")
+	start := time.Now()
 	for _, item := range t.config.Cron {
-		job := gocron.Every(item.Every)
-		job = t.getJobType(job, item.Every, item.Type)
-
-		if item.At != "" {
-			job = job.At(item.At)
+		schedule, errSchedule := jobSchedule(item, start)
+		if errSchedule != nil {
+			log.Fatalf("job=%s error=%s", item.Name, errSchedule.Error())
 		}
 
-		job.Do(t.Exec(item))
-		Logf("Job name=%s every=%d type=%s specific_day=%s at=%s is registered ...\n", item.Name, item.Every, item.Type, item.SpecificDay, item.At)
+		exec := t.Exec(item)
+		job := cron.NewChain(cron.SkipIfStillRunning(cron.DefaultLogger)).Then(cron.FuncJob(func() {
+			t.mutex.Lock()
+			defer t.mutex.Unlock()
+			exec()
+		}))
+
+		t.scheduler.Schedule(schedule, job)
+		Logf("Job name=%s schedule=%s every=%d type=%s specific_day=%s at=%s is registered ...\n", item.Name, item.Schedule, item.Every, item.Type, item.SpecificDay, item.At)
 	}
 
 	Log("Done registering jobs")
 }
 
-func (t *Task) getJobType(job *gocron.Job, every uint64, defaultType string) *gocron.Job {
-	if every > 1 {
-		defaultType = defaultType + "s"
-	}
-
-	switch defaultType {
-	case "second":
-		job = job.Second()
-		break
-	case "seconds":
-		job = job.Seconds()
-		break
-	case "minute":
-		job = job.Minute()
-		break
-	case "minutes":
-		job = job.Minutes()
-		break
-	case "hour":
-		job = job.Hour()
-		break
-	case "hours":
-		job = job.Hours()
-		break
-	case "days":
-		job = job.Days()
-		break
-	case "day":
-		job = job.Day()
-		break
-	default:
-		job = job.Day()
-	}
-
-	return job
-}
-
 // Exec will execute the job based on submitted config
 // Following are the steps for exec method:
 //
@@ -104,17 +119,15 @@ func (t *Task) Exec(crondata Cron) func() {
 	return func() {
 		Logf("Job name=%s\n", crondata.Name)
 
-		clientType := strings.ToLower(t.config.Source.Type)
-		clientSession := InitiateFTPClient(clientType, t.config)
-		defer clientSession.Close()
-
-		folderPath := crondata.Task.SourceFolder
-		errReaddirSourceFolder := clientSession.ReaddirSourceFolder(crondata)
-		if errReaddirSourceFolder != nil {
-			Logf("Failed to list directory dir=%s error=%s\n", folderPath, errReaddirSourceFolder.Error())
+		source := t.config.JobSource(crondata)
+		clientType := strings.ToLower(source.Type)
+		clientSession, errClient := InitiateFTPClient(clientType, source, crondata)
+		if errClient != nil {
+			Logf("Failed to read source type=%s dir=%s error=%s\n", clientType, crondata.Task.SourceFolder, errClient.Error())
 			Log("----------------------------------")
 			return
 		}
+		defer clientSession.Close()
 
 		filenames := clientSession.GetFilenameToDownload()
 		if len(filenames) == 0 {
@@ -123,105 +136,167 @@ func (t *Task) Exec(crondata Cron) func() {
 			return
 		}
 
+		runID := NewRunID()
 		for _, filename := range filenames {
-			t.ProcessFile(clientSession, folderPath, filename)
+			t.ProcessFile(clientSession, crondata, runID, filename)
 		}
 	}
 }
 
-func (t *Task) ProcessFile(cli Interface, folderPath, filename string) {
-	// This is to check whether cron.source.folder is local folder
-	if strings.Contains(filename, "/") {
-		t.Upload(filename)
+// ProcessFile streams a file from source to the targets it is routed to. The file is marked
+// as processed and archived only when it is delivered to every required target,
+// targets that already received it are skipped when it is processed again. A target on which
+// the file failed permanently is skipped until the file is modified
+func (t *Task) ProcessFile(cli Interface, crondata Cron, runID, filename string) {
+	filepath := filename
+
+	// Local folder source already returns the full file path
+	if !strings.Contains(filename, "/") {
+		filepath = crondata.Task.SourceFolder + `/` + filename
+	}
+
+	uploaders, isDropped, errRoute := t.Route(cli, crondata, filepath)
+	if errRoute != nil {
+		Logf("Failed to route file=%s error=%s\n", filepath, errRoute.Error())
 		return
 	}
 
-	filepath := folderPath + `/` + filename
-	errDownloadTempFile := cli.DownloadTempFile(filepath)
-	if errDownloadTempFile != nil {
-		Logf("Failed to download filepath=%s error=%s\n", filepath, errDownloadTempFile.Error())
-		Log("----------------------------------")
+	if isDropped {
+		markFileProcessed(crondata, filename)
 		return
 	}
 
-	t.Upload(filepath)
-}
+	isDelivered := true
+	for _, uploader := range uploaders {
+		target := uploader.target
+		if isFileDelivered(crondata, filename, target.Name) {
+			Logf("File=%s is already delivered to target=%s\n", filepath, target.Name)
+			continue
+		}
 
-// Upload is used to uplad download temp file to destination
-func (t *Task) Upload(tempfilepath string) {
-	Logf("Uploading file=%s ...\n", tempfilepath)
+		if isFileFailed(crondata, filename, target.Name) {
+			Logf("File=%s is failed on target=%s, it is skipped until it is modified\n", filepath, target.Name)
+			if !target.Optional {
+				isDelivered = false
+			}
+			continue
+		}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+		errUpload := t.Upload(cli, uploader, crondata, runID, filepath)
+		if errors.Is(errUpload, ErrNotModified) {
+			return
+		}
 
-	for _, uploadItem := range t.config.Target.Upload {
-		if uploadItem["key"] == uploadItem["value"] {
-			file, err := os.Open(tempfilepath)
-			if err != nil {
-				Logf("Failed to upload file=%s error=%s\n", tempfilepath, err.Error())
-				Log("----------------------------------")
-				return
-			}
-			defer file.Close()
+		if errUpload == nil {
+			markFileDelivered(crondata, filename, target.Name)
+			continue
+		}
 
-			part, err := writer.CreateFormFile(uploadItem["key"], filepath.Base(tempfilepath))
-			if err != nil {
-				Logf("Failed to upload file=%s error=%s\n", tempfilepath, err.Error())
-				Log("----------------------------------")
-				return
-			}
-			_, _ = io.Copy(part, file)
-		} else {
-			writer.WriteField(uploadItem["key"], uploadItem["value"])
+		var uploadErr *UploadError
+		if errors.As(errUpload, &uploadErr) {
+			t.Quarantine(cli, crondata, target.Name, filepath, uploadErr)
 		}
+		markFileFailed(crondata, filename, target.Name)
+
+		if target.Optional {
+			Logf("Optional target=%s is failed, file=%s is not blocked\n", target.Name, filepath)
+			continue
+		}
+		isDelivered = false
 	}
 
-	errWriterClose := writer.Close()
-	if errWriterClose != nil {
-		Logf("Failed to upload file=%s error=%s\n", tempfilepath, errWriterClose.Error())
-		Log("----------------------------------")
+	if !isDelivered {
+		Logf("File=%s is not delivered to every required target\n", filepath)
 		return
 	}
 
-	req, err := http.NewRequest("POST", t.config.Target.Host, body)
-	if err != nil {
-		Logf("Failed to upload file=%s error=%s...\n", tempfilepath, err.Error())
-		Log("----------------------------------")
+	markFileProcessed(crondata, filename)
+	t.Archive(cli, crondata, filepath)
+}
+
+// Quarantine copies a file which failed permanently into quarantine.folder
+func (t *Task) Quarantine(cli Interface, crondata Cron, target, filepath string, uploadErr *UploadError) {
+	if t.config.Quarantine.Folder == "" {
 		return
 	}
 
-	for _, header := range t.config.Target.Header {
-		req.Header.Set(header["key"], header["value"])
+	record, errQuarantine := NewQuarantineFolder(t.config.Quarantine.Folder).Add(cli, crondata.Name, target, filepath, uploadErr)
+	if errQuarantine != nil {
+		Logf("Failed to quarantine file=%s error=%s\n", filepath, errQuarantine.Error())
+		return
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	httpclient := &http.Client{Timeout: time.Duration(t.config.Target.Timeout) * time.Second}
-	resp, err := httpclient.Do(req)
-	if err != nil {
-		Logf("Failed to receive response when uploading file=%s error=%s\n", tempfilepath, err.Error())
-		Log("Retrying file upload in 5s ...")
-		Log("----------------------------------")
-		time.Sleep(5 * time.Second)
-		t.Upload(tempfilepath)
+	Logf("File=%s has been quarantined id=%s\n", filepath, record.ID)
+}
+
+// Archive lets the source archive the uploaded file, files are moved into
+// cron.task.archive_folder when it is set
+func (t *Task) Archive(cli Interface, crondata Cron, filepath string) {
+	archiver, ok := cli.(Archiver)
+	if !ok {
+		if crondata.Task.ArchiveFolder != "" {
+			Logf("Source type=%s does not support archiving file=%s\n", t.config.JobSource(crondata).Type, filepath)
+		}
 		return
 	}
 
-	if resp.StatusCode != 200 {
-		Logf("Failed to upload file got status_code=%s\n", strconv.Itoa(resp.StatusCode))
-		Log("Retrying file upload in 5s ...")
-		Log("----------------------------------")
-		time.Sleep(5 * time.Second)
-		t.Upload(tempfilepath)
+	errArchive := archiver.Archive(filepath, crondata.Task.ArchiveFolder)
+	if errArchive != nil {
+		Logf("Failed to archive file=%s error=%s\n", filepath, errArchive.Error())
 		return
 	}
 
-	Log("File has been uploaded successfully")
+	if crondata.Task.ArchiveFolder != "" {
+		Logf("File=%s has been archived to folder=%s\n", filepath, crondata.Task.ArchiveFolder)
+	}
+}
+
+// Upload is used to stream a file from source to a target destination,
+// failed attempts are retried following target.retry policy
+func (t *Task) Upload(cli Interface, uploader *Uploader, crondata Cron, runID, filepath string) error {
+	Logf("Uploading file=%s target=%s ...\n", filepath, uploader.target.Name)
+
+	policy := NewRetryPolicy(uploader.target.Retry)
+
+	var errUpload error
+	attempts := make([]Attempt, 0)
+	attempt := 1
+	for ; ; attempt++ {
+		startedAt := time.Now()
+
+		var data *TemplateData
+		data, errUpload = t.NewTemplateData(cli, uploader, crondata, runID, filepath)
+		if errUpload == nil {
+			errUpload = uploader.uploadOnce(cli, filepath, data)
+		}
+
+		attempts = append(attempts, NewAttempt(attempt, startedAt, errUpload))
+		if !policy.ShouldRetry(attempt, errUpload) {
+			break
+		}
+
+		wait := policy.Backoff(attempt)
+		Logf("Failed to upload file=%s attempt=%d error=%s\n", filepath, attempt, errUpload.Error())
+		Logf("Retrying file upload in %s ...\n", wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
+
+	if errors.Is(errUpload, ErrNotModified) {
+		Logf("File is not modified since the last upload file=%s\n", filepath)
+		Log("----------------------------------")
+		return errUpload
+	}
 
-	if !strings.Contains(tempfilepath, "/") {
-		Log("Removing temp file ...")
-		_ = os.Remove(tempfilepath)
+	if errUpload != nil {
+		Logf("Failed to upload file=%s target=%s attempts=%d error=%s\n", filepath, uploader.target.Name, attempt, errUpload.Error())
+		Logf("Job is failed\n")
+		Log("----------------------------------")
+		return &UploadError{Attempts: attempts, Err: errUpload}
 	}
 
+	Logf("File has been uploaded successfully target=%s\n", uploader.target.Name)
 	Logf("Job is done\n")
 	Log("----------------------------------")
+
+	return nil
 }
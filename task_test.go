@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessFileFailedTarget(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		if r.URL.Path == "/primary" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	fixture := newUploadFixture(t, "CIMB_20261019.csv", &Config{
+		Targets: []Target{
+			{Name: "primary", Host: server.URL + "/primary", Mode: "raw"},
+			{Name: "backup", Host: server.URL + "/backup", Mode: "raw"},
+		},
+		Quarantine: Quarantine{Folder: t.TempDir()},
+		Cron: []Cron{{
+			Name: "failed",
+			Task: CronTask{FilePrefix: "CIMB", FilePrefixDelimiter: "_", FilePrefixIndex: 1},
+		}},
+	})
+	filepath := fixture.filepath
+	crondata := fixture.config.Cron[0]
+	crondata.Task.SourceFolder = fixture.folder
+
+	run := func() []string {
+		cli := NewLocalFolder(fixture.folder)
+		assert.Nil(t, cli.ReaddirSourceFolder(crondata))
+		for _, filename := range cli.GetFilenameToDownload() {
+			fixture.task.ProcessFile(cli, crondata, NewRunID(), filename)
+		}
+		return cli.GetFilenameToDownload()
+	}
+
+	// The file is quarantined once, the next run skips the failed and the delivered target
+	assert.Equal(t, []string{filepath}, run())
+	assert.Equal(t, []string{filepath}, run())
+	assert.Equal(t, map[string]int{"/primary": 1, "/backup": 1}, requests)
+
+	records, err := NewQuarantineFolder(fixture.config.Quarantine.Folder).List()
+	assert.Nil(t, err)
+	assert.Len(t, records, 1)
+
+	// A modified file is delivered again to every target
+	modTime := time.Now().Add(time.Second)
+	assert.Nil(t, os.Chtimes(filepath, modTime, modTime))
+	run()
+	assert.Equal(t, map[string]int{"/primary": 2, "/backup": 2}, requests)
+}
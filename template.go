@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is the data available in target header, query and upload values
+// and target filename, e.g. `{{.Job}}-{{.Date.Format "20060102"}}-{{.Filename}}`
+type TemplateData struct {
+	Filename string
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	SHA256   string
+	Job      string
+	RunID    string
+	Date     time.Time
+	Match    map[string]string
+}
+
+// NewRunID returns a random id identifying a single run of a job
+func NewRunID() string {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// NewTemplateData returns the template data of a file uploaded to a target. Match contains
+// the groups captured by cron.task.file_prefix, by their name and by their index
+func (t *Task) NewTemplateData(cli Interface, uploader *Uploader, crondata Cron, runID, filepath string) (*TemplateData, error) {
+	data := &TemplateData{
+		Filename: path.Base(filepath),
+		Path:     t.relativePath(crondata, filepath),
+		Job:      crondata.Name,
+		RunID:    runID,
+		Date:     time.Now().In(jobLocation(crondata)),
+		Match:    make(map[string]string),
+	}
+
+	if stater, ok := cli.(Stater); ok {
+		info, errStat := stater.Stat(filepath)
+		if errStat != nil {
+			Logf("Failed to stat file=%s error=%s\n", filepath, errStat.Error())
+		} else {
+			data.Size = info.Size()
+			data.ModTime = info.ModTime()
+		}
+	}
+
+	if crondata.Task.FilePrefix != "" {
+		pattern, errPattern := regexp.Compile(crondata.Task.FilePrefix)
+		if errPattern != nil {
+			return nil, errPattern
+		}
+
+		matches := pattern.FindStringSubmatch(data.Filename)
+		for index, name := range pattern.SubexpNames() {
+			if index == 0 || index >= len(matches) {
+				continue
+			}
+
+			data.Match[strconv.Itoa(index)] = matches[index]
+			if name != "" {
+				data.Match[name] = matches[index]
+			}
+		}
+	}
+
+	// The checksum needs a full read of the file, so it is only computed when a template uses it
+	if uploader.isTemplateVar("SHA256") {
+		checksum, errChecksum := sha256File(cli, filepath)
+		if errChecksum != nil {
+			return nil, errChecksum
+		}
+		data.SHA256 = checksum
+	}
+
+	return data, nil
+}
+
+// Render executes a template against the data, text without an action is returned as is
+func (d *TemplateData) Render(text string) (string, error) {
+	return renderTemplate(text, d)
+}
+
+func renderTemplate(text string, data interface{}) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template %s: %s", text, err.Error())
+	}
+
+	var result strings.Builder
+	err = tmpl.Execute(&result, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute template %s: %s", text, err.Error())
+	}
+
+	return result.String(), nil
+}
+
+// isTemplateVar checks whether a target template refers to a template variable
+func (u *Uploader) isTemplateVar(name string) bool {
+	texts := []string{u.target.Filename}
+	for _, item := range u.target.Header {
+		texts = append(texts, item["value"])
+	}
+	for _, item := range u.target.Upload {
+		texts = append(texts, item["value"])
+	}
+	for _, item := range u.target.Query {
+		texts = append(texts, item["value"])
+	}
+	for _, step := range u.target.Steps {
+		texts = append(texts, step.URL, step.Body)
+		for _, item := range step.Header {
+			texts = append(texts, item["value"])
+		}
+	}
+	texts = append(texts, u.target.Signing.Canonical)
+	for _, item := range u.target.Signing.Header {
+		texts = append(texts, item["value"])
+	}
+
+	for _, text := range texts {
+		if strings.Contains(text, "{{") && strings.Contains(text, "."+name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// relativePath returns the file path relative to the job folder or the source folder
+func (t *Task) relativePath(crondata Cron, filepath string) string {
+	for _, folder := range []string{crondata.Task.SourceFolder, t.config.JobSource(crondata).Folder} {
+		folder = strings.TrimSuffix(folder, "/")
+		if folder != "" && strings.HasPrefix(filepath, folder+"/") {
+			return strings.TrimPrefix(filepath, folder+"/")
+		}
+	}
+
+	return path.Base(filepath)
+}
+
+// sha256File reads the whole file from source and returns its hex encoded SHA-256
+func sha256File(cli Interface, filepath string) (string, error) {
+	file, err := cli.ReadFile(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateDataRender(t *testing.T) {
+	data := &TemplateData{
+		Filename: "INV_0042.csv",
+		Size:     12,
+		Job:      "invoices",
+		Date:     time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+		Match:    map[string]string{"1": "0042", "code": "0042"},
+	}
+
+	result, err := data.Render(`{{.Job}}-{{.Date.Format "20060102"}}-{{.Match.code}}-{{.Size}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, "invoices-20260102-0042-12", result)
+
+	result, err = data.Render("static")
+	assert.Nil(t, err)
+	assert.Equal(t, "static", result)
+
+	_, err = data.Render("{{.Missing}}")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// NewHTTPClient returns the http client shared by every upload to the target,
+// connections are kept alive and reused between uploads
+func NewHTTPClient(target Target) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(target.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := newProxy(target.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(target.Timeout) * time.Second,
+	}, nil
+}
+
+// NewSourceHTTPClient returns the http client of http and webdav sources. A connect, TLS handshake,
+// response or read which makes no progress within timeout fails, so a hung server does not block
+// the job while large files can still be streamed
+func NewSourceHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			return &timeoutConn{Conn: conn, timeout: timeout}, nil
+		},
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// timeoutConn fails a read or write on a connection which makes no progress within timeout
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(p)
+}
+
+func (c *timeoutConn) Write(p []byte) (int, error) {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Write(p)
+}
+
+// newTLSConfig returns the tls config of target.tls with its CA bundle and client certificate
+func newTLSConfig(config TargetTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	switch config.MinVersion {
+	case ``:
+		break
+	case `1.0`:
+		tlsConfig.MinVersion = tls.VersionTLS10
+		break
+	case `1.1`:
+		tlsConfig.MinVersion = tls.VersionTLS11
+		break
+	case `1.2`:
+		tlsConfig.MinVersion = tls.VersionTLS12
+		break
+	case `1.3`:
+		tlsConfig.MinVersion = tls.VersionTLS13
+		break
+	default:
+		return nil, fmt.Errorf("unknown tls min_version %s, use 1.0, 1.1, 1.2 or 1.3", config.MinVersion)
+	}
+
+	if config.CA != "" {
+		ca, err := ioutil.ReadFile(config.CA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate is found in tls ca=%s", config.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// newProxy returns the proxy of target.proxy, http, https and socks5 proxies are supported.
+// Proxy environment variables are used when target.proxy is not set
+func newProxy(config Proxy) (func(*http.Request) (*url.URL, error), error) {
+	if config.URL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch proxyURL.Scheme {
+	case `http`, `https`, `socks5`:
+		break
+	default:
+		return nil, fmt.Errorf("unknown proxy scheme %s, use http, https or socks5", proxyURL.Scheme)
+	}
+
+	if config.Username != "" {
+		proxyURL.User = url.UserPassword(config.Username, config.Password)
+	}
+
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    strings.Join(config.NoProxy, ","),
+	}).ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
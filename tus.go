@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// TusVersion is the version of the tus resumable upload protocol
+const TusVersion = "1.0.0"
+
+// Defaults of target.tus
+const (
+	DefaultTusChunkSize = 8 << 20
+	DefaultTusStateFile = "kintoun-tus.json"
+)
+
+var tusStateMutex sync.Mutex
+
+// TusTarget uploads files using the tus resumable upload protocol, the upload url
+// of every unfinished upload is kept in a state file so it can be resumed
+type TusTarget struct {
+	httpclient *http.Client
+	host       string
+	header     http.Header
+	chunkSize  int64
+	stateFile  string
+}
+
+// NewTusTarget initiates tus target client, header is sent with every request
+func NewTusTarget(host string, header http.Header, chunkSize int64, stateFile string, httpclient *http.Client) *TusTarget {
+	if chunkSize <= 0 {
+		chunkSize = DefaultTusChunkSize
+	}
+	if stateFile == "" {
+		stateFile = DefaultTusStateFile
+	}
+
+	return &TusTarget{
+		httpclient: httpclient,
+		host:       host,
+		header:     header,
+		chunkSize:  chunkSize,
+		stateFile:  stateFile,
+	}
+}
+
+// Upload creates the upload or resumes it from the offset returned by the server,
+// then sends the file in chunks using PATCH. key identifies the file in the state file
+func (t *TusTarget) Upload(key, filename string, size int64, file io.Reader) error {
+	uploadURL, offset, err := t.resume(key)
+	if err != nil {
+		return err
+	}
+
+	if uploadURL == "" {
+		uploadURL, err = t.create(filename, size)
+		if err != nil {
+			return err
+		}
+
+		err = t.saveState(key, uploadURL)
+		if err != nil {
+			return err
+		}
+	} else {
+		Logf("Resuming tus upload url=%s offset=%d\n", uploadURL, offset)
+	}
+
+	// The source is always read from the start, bytes already received by the server are skipped
+	_, err = io.CopyN(ioutil.Discard, file, offset)
+	if err != nil {
+		return err
+	}
+
+	for offset < size {
+		offset, err = t.patch(uploadURL, offset, size, file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return t.saveState(key, "")
+}
+
+// resume returns the upload url and offset of an unfinished upload, the upload
+// is started again when the server does not know it anymore
+func (t *TusTarget) resume(key string) (string, int64, error) {
+	state, err := t.readState()
+	if err != nil {
+		return "", 0, err
+	}
+
+	uploadURL := state[key]
+	if uploadURL == "" {
+		return "", 0, nil
+	}
+
+	resp, err := t.do("HEAD", uploadURL, nil, -1)
+	if err != nil {
+		return "", 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusForbidden {
+		Logf("Tus upload url=%s is not found, the upload is started again\n", uploadURL)
+		return "", 0, t.saveState(key, "")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", 0, &StatusError{StatusCode: resp.StatusCode, Reason: "failed to get tus upload offset"}
+	}
+
+	offset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid tus Upload-Offset %s", resp.Header.Get("Upload-Offset"))
+	}
+
+	return uploadURL, offset, nil
+}
+
+func (t *TusTarget) create(filename string, size int64) (string, error) {
+	header := http.Header{}
+	header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(filename)))
+
+	resp, err := t.do("POST", t.host, header, 0)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxResponseBodySize))
+		return "", &StatusError{StatusCode: resp.StatusCode, Body: string(body), Reason: "failed to create tus upload"}
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return "", fmt.Errorf("tus server responds without a valid Location")
+	}
+
+	return location.String(), nil
+}
+
+func (t *TusTarget) patch(uploadURL string, offset, size int64, file io.Reader) (int64, error) {
+	length := size - offset
+	if length > t.chunkSize {
+		length = t.chunkSize
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/offset+octet-stream")
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	resp, err := t.doBody("PATCH", uploadURL, header, io.LimitReader(file, length), length)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxResponseBodySize))
+		return offset, &StatusError{StatusCode: resp.StatusCode, Body: string(body), Reason: "failed to upload tus chunk"}
+	}
+
+	newOffset, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || newOffset != offset+length {
+		return offset, fmt.Errorf("unexpected tus Upload-Offset %s", resp.Header.Get("Upload-Offset"))
+	}
+
+	return newOffset, nil
+}
+
+func (t *TusTarget) do(method, requestURL string, header http.Header, contentLength int64) (*http.Response, error) {
+	return t.doBody(method, requestURL, header, nil, contentLength)
+}
+
+func (t *TusTarget) doBody(method, requestURL string, header http.Header, body io.Reader, contentLength int64) (*http.Response, error) {
+	req, err := http.NewRequest(method, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range t.header {
+		req.Header[key] = values
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Tus-Resumable", TusVersion)
+	if contentLength >= 0 {
+		req.ContentLength = contentLength
+	}
+
+	return t.httpclient.Do(req)
+}
+
+// readState returns upload urls of unfinished uploads by their key
+func (t *TusTarget) readState() (map[string]string, error) {
+	tusStateMutex.Lock()
+	defer tusStateMutex.Unlock()
+
+	return readTusState(t.stateFile)
+}
+
+// saveState stores the upload url of a key, an empty url removes the key
+func (t *TusTarget) saveState(key, uploadURL string) error {
+	tusStateMutex.Lock()
+	defer tusStateMutex.Unlock()
+
+	state, err := readTusState(t.stateFile)
+	if err != nil {
+		return err
+	}
+
+	if uploadURL == "" {
+		delete(state, key)
+	} else {
+		state[key] = uploadURL
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The state is written into a temporary file first so it is never left half written
+	errWrite := ioutil.WriteFile(t.stateFile+".tmp", data, 0600)
+	if errWrite != nil {
+		return errWrite
+	}
+
+	return os.Rename(t.stateFile+".tmp", t.stateFile)
+}
+
+func readTusState(stateFile string) (map[string]string, error) {
+	state := make(map[string]string)
+
+	data, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tus state file=%s error=%s", stateFile, err.Error())
+	}
+
+	return state, nil
+}
+
+// tusKey identifies a file uploaded to a target host in the tus state, so targets sharing
+// a state file never resume each other's uploads. A modified file is uploaded again from the start
+func tusKey(data *TemplateData, target, host, filepath string, size int64) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%d", data.Job, target, host, filepath, size, data.ModTime.Unix())
+}
+
+// sizeFile reads the whole file from source and returns its size,
+// it is used when the source cannot return the size of a file
+func sizeFile(cli Interface, filepath string) (int64, error) {
+	file, err := cli.ReadFile(filepath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return io.Copy(ioutil.Discard, file)
+}
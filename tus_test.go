@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tusServer is a minimal tus server keeping uploads in memory
+type tusServer struct {
+	mutex     sync.Mutex
+	uploads   map[string][]byte
+	lengths   map[string]int64
+	requests  []string
+	failPatch int
+	gone      int
+}
+
+func newTusServer(t *testing.T, state *tusServer) *httptest.Server {
+	state.uploads = make(map[string][]byte)
+	state.lengths = make(map[string]int64)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state.mutex.Lock()
+		defer state.mutex.Unlock()
+
+		assert.Equal(t, TusVersion, r.Header.Get("Tus-Resumable"))
+		id := strings.TrimPrefix(r.URL.Path, "/files/")
+
+		switch r.Method {
+		case `POST`:
+			state.requests = append(state.requests, "POST")
+			length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+			assert.Nil(t, err)
+
+			id = strconv.Itoa(len(state.lengths) + 1)
+			state.uploads[id] = []byte{}
+			state.lengths[id] = length
+			w.Header().Set("Location", "/files/"+id)
+			w.WriteHeader(http.StatusCreated)
+		case `HEAD`:
+			state.requests = append(state.requests, "HEAD")
+			if _, ok := state.uploads[id]; !ok {
+				w.WriteHeader(state.gone)
+				return
+			}
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(state.uploads[id])))
+		case `PATCH`:
+			body, err := ioutil.ReadAll(r.Body)
+			assert.Nil(t, err)
+			state.requests = append(state.requests, fmt.Sprintf("PATCH %s+%d", r.Header.Get("Upload-Offset"), len(body)))
+			assert.Equal(t, "application/offset+octet-stream", r.Header.Get("Content-Type"))
+			assert.Equal(t, strconv.Itoa(len(state.uploads[id])), r.Header.Get("Upload-Offset"))
+
+			state.failPatch--
+			if state.failPatch == 0 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			state.uploads[id] = append(state.uploads[id], body...)
+			w.Header().Set("Upload-Offset", strconv.Itoa(len(state.uploads[id])))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func newTusStateFile(t *testing.T) (string, func()) {
+	folder, err := ioutil.TempDir("", "kintoun-tus")
+	assert.Nil(t, err)
+
+	return filepath.Join(folder, "tus.json"), func() { os.RemoveAll(folder) }
+}
+
+const tusContent = "id,amount\n1,100\n"
+
+func TestTusUploadChunks(t *testing.T) {
+	state := &tusServer{}
+	server := newTusServer(t, state)
+	defer server.Close()
+	stateFile, cleanup := newTusStateFile(t)
+	defer cleanup()
+
+	tus := NewTusTarget(server.URL+"/files/", http.Header{}, 6, stateFile, http.DefaultClient)
+	err := tus.Upload("a.csv", "a.csv", int64(len(tusContent)), strings.NewReader(tusContent))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"POST", "PATCH 0+6", "PATCH 6+6", "PATCH 12+4"}, state.requests)
+	assert.Equal(t, tusContent, string(state.uploads["1"]))
+
+	// The upload url is removed from the state once the upload is finished
+	saved, err := readTusState(stateFile)
+	assert.Nil(t, err)
+	assert.Empty(t, saved)
+}
+
+func TestTusUploadResume(t *testing.T) {
+	state := &tusServer{failPatch: 2}
+	server := newTusServer(t, state)
+	defer server.Close()
+	stateFile, cleanup := newTusStateFile(t)
+	defer cleanup()
+
+	tus := NewTusTarget(server.URL+"/files/", http.Header{}, 6, stateFile, http.DefaultClient)
+	err := tus.Upload("a.csv", "a.csv", int64(len(tusContent)), strings.NewReader(tusContent))
+	assert.NotNil(t, err)
+
+	saved, err := readTusState(stateFile)
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/files/1", saved["a.csv"])
+
+	// The next attempt asks the offset and sends only the remaining bytes
+	state.requests = nil
+	err = tus.Upload("a.csv", "a.csv", int64(len(tusContent)), strings.NewReader(tusContent))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"HEAD", "PATCH 6+6", "PATCH 12+4"}, state.requests)
+	assert.Equal(t, tusContent, string(state.uploads["1"]))
+}
+
+func TestTusUploadRestart(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusGone} {
+		state := &tusServer{gone: status}
+		server := newTusServer(t, state)
+		stateFile, cleanup := newTusStateFile(t)
+
+		tus := NewTusTarget(server.URL+"/files/", http.Header{}, 0, stateFile, http.DefaultClient)
+		assert.Nil(t, tus.saveState("a.csv", server.URL+"/files/expired"))
+
+		err := tus.Upload("a.csv", "a.csv", int64(len(tusContent)), strings.NewReader(tusContent))
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"HEAD", "POST", "PATCH 0+16"}, state.requests, status)
+		assert.Equal(t, tusContent, string(state.uploads["1"]))
+
+		server.Close()
+		cleanup()
+	}
+}
+
+func TestTusKey(t *testing.T) {
+	data := &TemplateData{Job: "daily", ModTime: time.Unix(1760832000, 0)}
+
+	key := tusKey(data, "primary", "https://a.example.com/files/", "/in/a.csv", 16)
+	assert.Equal(t, "daily|primary|https://a.example.com/files/|/in/a.csv|16|1760832000", key)
+	assert.NotEqual(t, key, tusKey(data, "backup", "https://a.example.com/files/", "/in/a.csv", 16))
+	assert.NotEqual(t, key, tusKey(data, "primary", "https://b.example.com/files/", "/in/a.csv", 16))
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Uploader delivers files to a target, its http client and oauth2 token
+// are shared by every upload to the target
+type Uploader struct {
+	target     Target
+	httpclient *http.Client
+	oauth2     *OAuth2Client
+	endpoints  *EndpointPool
+}
+
+// NewUploader returns the uploader of a target
+func NewUploader(target Target) (*Uploader, error) {
+	err := validateSigning(target)
+	if err != nil {
+		return nil, err
+	}
+
+	httpclient, err := NewHTTPClient(target)
+	if err != nil {
+		return nil, err
+	}
+
+	uploader := &Uploader{
+		target:     target,
+		httpclient: httpclient,
+	}
+
+	if target.OAuth2.TokenURL != "" {
+		uploader.oauth2 = NewOAuth2Client(target.OAuth2, httpclient)
+	}
+
+	if len(target.Endpoints) > 0 {
+		uploader.endpoints = NewEndpointPool(target.Strategy, target.Endpoints, target.Cooldown)
+	}
+
+	return uploader, nil
+}
+
+// uploadOnce uploads the file to target.host, or to target.endpoints where an endpoint
+// which fails is replaced right away by the next candidate
+func (u *Uploader) uploadOnce(cli Interface, filepath string, data *TemplateData) error {
+	if u.endpoints == nil {
+		return u.uploadEndpoint(cli, filepath, data)
+	}
+
+	var errUpload error
+	for _, endpoint := range u.endpoints.Candidates() {
+		// The copy shares the http client and the oauth2 token of the uploader
+		endpointUploader := *u
+		endpointUploader.target.Host = endpoint
+
+		errUpload = endpointUploader.uploadEndpoint(cli, filepath, data)
+		if errUpload == nil {
+			u.endpoints.MarkHealthy(endpoint)
+			return nil
+		}
+
+		if !isEndpointError(errUpload) {
+			return errUpload
+		}
+
+		Logf("Endpoint=%s is failed, it is out of rotation error=%s\n", endpoint, errUpload.Error())
+		u.endpoints.MarkFailed(endpoint)
+	}
+
+	return errUpload
+}
+
+func (u *Uploader) uploadEndpoint(cli Interface, filepath string, data *TemplateData) error {
+	var upload func(cli Interface, filepath string, data *TemplateData) error
+
+	switch strings.ToLower(u.target.Type) {
+	case `webdav`:
+		return u.uploadWebDAV(cli, filepath, data)
+	case `tus`:
+		upload = u.uploadTus
+		break
+	default:
+		upload = u.uploadHTTP
+		if len(u.target.Steps) > 0 {
+			upload = u.uploadSteps
+		}
+	}
+
+	errUpload := upload(cli, filepath, data)
+
+	// The cached token may be revoked before it expires, a fresh token is tried once
+	var statusErr *StatusError
+	if u.oauth2 != nil && errors.As(errUpload, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+		Log("Target responds 401, retrying with a new oauth2 token")
+		u.oauth2.Invalidate()
+		errUpload = upload(cli, filepath, data)
+	}
+
+	return errUpload
+}
+
+// targetFilename returns the uploaded filename from target.filename, the source filename is used by default
+func (u *Uploader) targetFilename(data *TemplateData) (string, error) {
+	if u.target.Filename == "" {
+		return data.Filename, nil
+	}
+
+	return data.Render(u.target.Filename)
+}
+
+func (u *Uploader) uploadWebDAV(cli Interface, filepath string, data *TemplateData) error {
+	filename, err := u.targetFilename(data)
+	if err != nil {
+		return err
+	}
+
+	file, err := cli.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	target := u.target
+	return NewWebDAVTarget(target.Host, target.Username, target.Password, target.Folder, u.httpclient).Upload(filename, file)
+}
+
+// uploadTus uploads the file using the tus protocol, an upload that was interrupted
+// by a failed attempt or a restart is resumed
+func (u *Uploader) uploadTus(cli Interface, filepath string, data *TemplateData) error {
+	filename, err := u.targetFilename(data)
+	if err != nil {
+		return err
+	}
+
+	size := data.Size
+	if size <= 0 {
+		size, err = sizeFile(cli, filepath)
+		if err != nil {
+			return err
+		}
+	}
+
+	header := http.Header{}
+	err = u.setTargetHeader(header, data)
+	if err != nil {
+		return err
+	}
+
+	file, err := cli.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tus := u.target.Tus
+	return NewTusTarget(u.target.Host, header, tus.ChunkSize, tus.StateFile, u.httpclient).Upload(tusKey(data, u.target.Name, u.target.Host, filepath, size), filename, size, file)
+}
+
+// uploadHTTP streams the file following target.mode, the body is written into a pipe
+// while the request is sent so the file is never held in memory
+func (u *Uploader) uploadHTTP(cli Interface, filepath string, data *TemplateData) error {
+	filename, err := u.targetFilename(data)
+	if err != nil {
+		return err
+	}
+
+	fields, err := u.renderUploadFields(data)
+	if err != nil {
+		return err
+	}
+
+	requestURL, err := u.targetURL(data)
+	if err != nil {
+		return err
+	}
+
+	method := strings.ToUpper(u.target.Method)
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequest(method, requestURL, nil)
+	if err != nil {
+		return err
+	}
+
+	err = u.setTargetHeader(req.Header, data)
+	if err != nil {
+		return err
+	}
+
+	contentType, writeBody := newBodyWriter(u.target.Mode, u.target.ContentType, filename, fields)
+	req.Header.Set("Content-Type", contentType)
+	if strings.ToLower(u.target.Mode) == `raw` && data.Size > 0 {
+		req.ContentLength = data.Size
+	}
+
+	if u.target.Signing.Key != "" {
+		err = u.sign(req, cli, filepath, writeBody, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := u.doStream(req, cli, filepath, writeBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := checkResponse(resp, u.target.Success)
+	if err != nil {
+		return err
+	}
+
+	if u.target.Poll.Status != "" {
+		return u.poll(resp, body, data)
+	}
+
+	return nil
+}
+
+// setTargetHeader sets rendered target.header and the oauth2 bearer token
+func (u *Uploader) setTargetHeader(header http.Header, data *TemplateData) error {
+	for _, item := range u.target.Header {
+		value, errRender := data.Render(item["value"])
+		if errRender != nil {
+			return errRender
+		}
+		header.Set(item["key"], value)
+	}
+
+	if u.oauth2 != nil {
+		token, errToken := u.oauth2.Token()
+		if errToken != nil {
+			return errToken
+		}
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return nil
+}
+
+// isTargetHost reports whether a request url is on target.host, target.header and the oauth2 token
+// are only sent to target.host, not to e.g. a presigned url or a status url on another host
+func (u *Uploader) isTargetHost(requestURL *url.URL) bool {
+	targetURL, err := url.Parse(u.target.Host)
+	if err != nil {
+		return false
+	}
+
+	return requestURL.Scheme == targetURL.Scheme && requestURL.Host == targetURL.Host
+}
+
+// doStream sends the request while its body is written from the source file
+func (u *Uploader) doStream(req *http.Request, cli Interface, filepath string, writeBody func(w io.Writer, file io.Reader) error) (*http.Response, error) {
+	file, err := cli.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	body, bodyWriter := io.Pipe()
+	req.Body = body
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer file.Close()
+		bodyWriter.CloseWithError(writeBody(bodyWriter, file))
+	}()
+
+	resp, err := u.httpclient.Do(req)
+
+	// The server may answer before reading the whole body, closing the pipe stops the writer
+	body.Close()
+	<-done
+
+	return resp, err
+}
+
+// checkResponse checks the response against success and returns the response body
+func checkResponse(resp *http.Response, success Success) ([]byte, error) {
+	body, errBody := ioutil.ReadAll(io.LimitReader(resp.Body, MaxResponseBodySize))
+	if errBody != nil {
+		return nil, errBody
+	}
+
+	for _, code := range success.Accept {
+		if resp.StatusCode == code {
+			Logf("Status_code=%d is accepted as success\n", resp.StatusCode)
+			return body, nil
+		}
+	}
+
+	isSuccessStatus := resp.StatusCode >= 200 && resp.StatusCode <= 299
+	if len(success.Status) > 0 {
+		isSuccessStatus = false
+		for _, code := range success.Status {
+			if resp.StatusCode == code {
+				isSuccessStatus = true
+				break
+			}
+		}
+	}
+
+	if !isSuccessStatus {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	if success.Body == "" {
+		return body, nil
+	}
+
+	var data interface{}
+	errDecode := json.Unmarshal(body, &data)
+	if errDecode != nil {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body), Reason: "failed to decode response body"}
+	}
+
+	isMatch, errCondition := JSONCondition(data, success.Body)
+	if errCondition != nil {
+		return nil, errCondition
+	}
+
+	if !isMatch {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body), Reason: fmt.Sprintf("response body does not match %s", success.Body)}
+	}
+
+	return body, nil
+}
+
+// newBodyWriter returns the content type and the writer of the request body following the upload mode,
+// the body is the same every time it is written so it can be signed
+func newBodyWriter(mode, contentType, filename string, fields []map[string]string) (string, func(w io.Writer, file io.Reader) error) {
+	switch strings.ToLower(mode) {
+	case `raw`:
+		if contentType == "" {
+			contentType = mime.TypeByExtension(path.Ext(filename))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		return contentType, func(w io.Writer, file io.Reader) error {
+			_, err := io.Copy(w, file)
+			return err
+		}
+	case `form-urlencoded-base64`:
+		return "application/x-www-form-urlencoded", func(w io.Writer, file io.Reader) error {
+			return writeFormBase64(w, file, fields)
+		}
+	default:
+		boundary := multipart.NewWriter(ioutil.Discard)
+
+		return boundary.FormDataContentType(), func(w io.Writer, file io.Reader) error {
+			writer := multipart.NewWriter(w)
+			writer.SetBoundary(boundary.Boundary())
+			return writeMultipart(writer, file, filename, fields)
+		}
+	}
+}
+
+// targetURL returns target.host with rendered target.query parameters
+func (u *Uploader) targetURL(data *TemplateData) (string, error) {
+	if len(u.target.Query) == 0 {
+		return u.target.Host, nil
+	}
+
+	requestURL, err := url.Parse(u.target.Host)
+	if err != nil {
+		return "", err
+	}
+
+	query := requestURL.Query()
+	for _, item := range u.target.Query {
+		value, errRender := data.Render(item["value"])
+		if errRender != nil {
+			return "", errRender
+		}
+		query.Add(item["key"], value)
+	}
+	requestURL.RawQuery = query.Encode()
+
+	return requestURL.String(), nil
+}
+
+// renderUploadFields returns target.upload with rendered field values, the file item is kept as is
+func (u *Uploader) renderUploadFields(data *TemplateData) ([]map[string]string, error) {
+	fields := make([]map[string]string, 0, len(u.target.Upload))
+	for _, uploadItem := range u.target.Upload {
+		if uploadItem["key"] == uploadItem["value"] {
+			fields = append(fields, uploadItem)
+			continue
+		}
+
+		value, err := data.Render(uploadItem["value"])
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, map[string]string{"key": uploadItem["key"], "value": value})
+	}
+
+	return fields, nil
+}
+
+// writeMultipart writes upload fields and the file into the multipart writer,
+// the field whose key and value are the same is the file
+func writeMultipart(writer *multipart.Writer, file io.Reader, filename string, fields []map[string]string) error {
+	for _, uploadItem := range fields {
+		if uploadItem["key"] == uploadItem["value"] {
+			part, err := writer.CreateFormFile(uploadItem["key"], filename)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(part, file)
+			if err != nil {
+				return err
+			}
+		} else {
+			writer.WriteField(uploadItem["key"], uploadItem["value"])
+		}
+	}
+
+	return writer.Close()
+}
+
+// writeFormBase64 writes upload fields as an url encoded form, the file is
+// encoded in base64 while it is streamed
+func writeFormBase64(w io.Writer, file io.Reader, fields []map[string]string) error {
+	for index, uploadItem := range fields {
+		if index > 0 {
+			_, err := io.WriteString(w, "&")
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := io.WriteString(w, url.QueryEscape(uploadItem["key"])+"=")
+		if err != nil {
+			return err
+		}
+
+		if uploadItem["key"] != uploadItem["value"] {
+			_, err = io.WriteString(w, url.QueryEscape(uploadItem["value"]))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		encoder := base64.NewEncoder(base64.StdEncoding, &queryEscapeWriter{w: w})
+		_, err = io.Copy(encoder, file)
+		if err != nil {
+			return err
+		}
+
+		err = encoder.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queryEscapeWriter escapes everything written to it for an url encoded form
+type queryEscapeWriter struct {
+	w io.Writer
+}
+
+func (q *queryEscapeWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(q.w, url.QueryEscape(string(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadFixture is a source folder with one file and the task of the jobs of config,
+// targets without a retry policy are tried once
+type uploadFixture struct {
+	config   *Config
+	task     *Task
+	cli      Interface
+	folder   string
+	filepath string
+}
+
+func newUploadFixture(t *testing.T, filename string, config *Config) *uploadFixture {
+	folder := t.TempDir()
+	filepath := filepath.Join(folder, filename)
+	assert.Nil(t, ioutil.WriteFile(filepath, []byte("id,amount\n1,100\n"), 0644))
+
+	if config.Target.Retry.MaxAttempts == 0 {
+		config.Target.Retry.MaxAttempts = 1
+	}
+	for index := range config.Targets {
+		if config.Targets[index].Retry.MaxAttempts == 0 {
+			config.Targets[index].Retry.MaxAttempts = 1
+		}
+	}
+	if len(config.Cron) == 0 {
+		config.Cron = []Cron{{Name: "upload"}}
+	}
+
+	return &uploadFixture{
+		config:   config,
+		task:     NewTask(config),
+		cli:      NewLocalFolder(folder),
+		folder:   folder,
+		filepath: filepath,
+	}
+}
+
+// Upload uploads the file of the fixture to a target of the first job
+func (f *uploadFixture) Upload(target string) error {
+	crondata := f.config.Cron[0]
+	return f.task.Upload(f.cli, f.task.Uploader(crondata.Name, target), crondata, NewRunID(), f.filepath)
+}
+
+func TestUploadSuccess(t *testing.T) {
+	status, body := http.StatusOK, ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	// Any 2xx is successful by default
+	fixture := newUploadFixture(t, "a.csv", &Config{Target: Target{Host: server.URL}})
+	for _, status = range []int{http.StatusOK, http.StatusCreated, http.StatusNoContent} {
+		assert.Nil(t, fixture.Upload(""), status)
+	}
+	status = http.StatusFound
+	assert.NotNil(t, fixture.Upload(""))
+
+	// success.status replaces the default, success.accept skips the body condition
+	fixture = newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host: server.URL,
+		Success: Success{
+			Status: []int{http.StatusCreated},
+			Accept: []int{http.StatusConflict},
+			Body:   `$.status == "OK"`,
+		},
+	}})
+
+	status, body = http.StatusOK, `{"status": "OK"}`
+	err := fixture.Upload("")
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusOK, statusErr.StatusCode)
+
+	status = http.StatusCreated
+	assert.Nil(t, fixture.Upload(""))
+
+	status, body = http.StatusConflict, `{"status": "DUPLICATE"}`
+	assert.Nil(t, fixture.Upload(""))
+}
+
+func TestUploadBodyNotMatching(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"status": "REJECTED"}`)
+	}))
+	defer server.Close()
+
+	fixture := newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host:    server.URL,
+		Retry:   Retry{MaxAttempts: 3},
+		Success: Success{Body: `$.status == "OK"`},
+	}})
+
+	// A response which does not match the body condition is failed and not retried
+	err := fixture.Upload("")
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusOK, statusErr.StatusCode)
+	assert.Equal(t, `{"status": "REJECTED"}`, statusErr.Body)
+	assert.Equal(t, 1, requests)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/studio-b12/gowebdav"
+)
+
+// WebDAV client, basic and digest authentication are negotiated with the server
+type WebDAV struct {
+	webdavclient       *gowebdav.Client
+	filenameToDownload []string
+}
+
+// NewWebDAV initiates WebDAV client
+func NewWebDAV(host, username, password string, timeout time.Duration) Interface {
+	webdavclient := gowebdav.NewClient(host, username, password)
+	webdavclient.SetTransport(NewSourceHTTPClient(timeout).Transport)
+
+	return &WebDAV{
+		webdavclient: webdavclient,
+	}
+}
+
+// ReaddirSourceFolder is used to read files in a collection using PROPFIND
+func (w *WebDAV) ReaddirSourceFolder(crondata Cron) error {
+	fileToDownload := make([]string, 0)
+
+	if crondata.Task.FilePrefix != "" {
+		sourceFiles, errSourceFiles := w.webdavclient.ReadDir(crondata.Task.SourceFolder)
+		if errSourceFiles != nil {
+			return errSourceFiles
+		}
+
+		for _, item := range sourceFiles {
+			if item.IsDir() {
+				continue
+			}
+
+			if isFileToDownload(crondata, item.Name(), item.ModTime()) {
+				fileToDownload = append(fileToDownload, item.Name())
+			}
+		}
+	} else {
+		fileToDownload = append(fileToDownload, crondata.Task.File)
+	}
+
+	w.SetFilenameToDownload(fileToDownload)
+
+	return nil
+}
+
+// SetFilenameToDownload is used to set a filename to download as temp file
+func (w *WebDAV) SetFilenameToDownload(filename []string) {
+	w.filenameToDownload = filename
+}
+
+// GetFilenameToDownload is used to get a filename to download as temp file
+func (w *WebDAV) GetFilenameToDownload() []string {
+	return w.filenameToDownload
+}
+
+// ReadFile opens the file for a streaming read using GET
+func (w *WebDAV) ReadFile(filepath string) (io.ReadCloser, error) {
+	Logf("Reading file=%s ...\n", filepath)
+
+	return w.webdavclient.ReadStream(filepath)
+}
+
+// Archive moves an uploaded file into the archive folder using MKCOL and MOVE
+func (w *WebDAV) Archive(filepath, archiveFolder string) error {
+	if archiveFolder == "" {
+		return nil
+	}
+
+	errMkdir := w.webdavclient.MkdirAll(archiveFolder, 0755)
+	if errMkdir != nil {
+		return errMkdir
+	}
+
+	return w.webdavclient.Rename(filepath, path.Join(archiveFolder, path.Base(filepath)), true)
+}
+
+// Stat returns the size and modified time of a file using PROPFIND
+func (w *WebDAV) Stat(filepath string) (os.FileInfo, error) {
+	return w.webdavclient.Stat(filepath)
+}
+
+// Close for webdav is do nothing
+func (w *WebDAV) Close() {}
+
+// WebDAVTarget uploads files to a WebDAV collection
+type WebDAVTarget struct {
+	webdavclient *gowebdav.Client
+	folder       string
+}
+
+// NewWebDAVTarget initiates WebDAV target client using the transport and timeout of the http client
+func NewWebDAVTarget(host, username, password, folder string, httpclient *http.Client) *WebDAVTarget {
+	webdavclient := gowebdav.NewClient(host, username, password)
+	webdavclient.SetTransport(httpclient.Transport)
+	webdavclient.SetTimeout(httpclient.Timeout)
+
+	return &WebDAVTarget{
+		webdavclient: webdavclient,
+		folder:       folder,
+	}
+}
+
+// Upload creates the target folder using MKCOL and streams the file using PUT
+func (w *WebDAVTarget) Upload(filename string, file io.Reader) error {
+	if w.folder != "" {
+		errMkdir := w.webdavclient.MkdirAll(w.folder, 0755)
+		if errMkdir != nil {
+			return errMkdir
+		}
+	}
+
+	errWrite := w.webdavclient.WriteStream(path.Join("/", w.folder, filename), file, 0644)
+
+	var statusErr gowebdav.StatusError
+	if errors.As(errWrite, &statusErr) {
+		return &StatusError{StatusCode: statusErr.Status}
+	}
+
+	return errWrite
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/webdav"
+)
+
+func newWebDAVServer(t *testing.T, status *int, methods *[]string) (*httptest.Server, webdav.FileSystem) {
+	filesystem := webdav.NewMemFS()
+	handler := &webdav.Handler{FileSystem: filesystem, LockSystem: webdav.NewMemLS()}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*methods = append(*methods, r.Method)
+		if r.Method == "PUT" && *status != 0 {
+			w.WriteHeader(*status)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+
+	return server, filesystem
+}
+
+func readWebDAVFile(t *testing.T, filesystem webdav.FileSystem, name string) string {
+	file, err := filesystem.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestWebDAVTargetUpload(t *testing.T) {
+	status := 0
+	methods := make([]string, 0)
+	server, filesystem := newWebDAVServer(t, &status, &methods)
+	defer server.Close()
+
+	target := NewWebDAVTarget(server.URL, "", "", "reports/daily", http.DefaultClient)
+	assert.Nil(t, target.Upload("a.csv", strings.NewReader("id,amount\n1,100\n")))
+	assert.Equal(t, "id,amount\n1,100\n", readWebDAVFile(t, filesystem, "/reports/daily/a.csv"))
+
+	// The folder is created using MKCOL before the file is sent using PUT
+	assert.Contains(t, methods, "MKCOL")
+	assert.Equal(t, "PUT", methods[len(methods)-1])
+
+	// A rejected upload is reported with its status code
+	status = http.StatusForbidden
+	err := target.Upload("b.csv", strings.NewReader("id,amount\n"))
+	var statusErr *StatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusForbidden, statusErr.StatusCode)
+}
+
+func TestWebDAVArchive(t *testing.T) {
+	status := 0
+	methods := make([]string, 0)
+	server, filesystem := newWebDAVServer(t, &status, &methods)
+	defer server.Close()
+
+	assert.Nil(t, filesystem.Mkdir(context.Background(), "/out", 0755))
+	file, err := filesystem.OpenFile(context.Background(), "/out/a.csv", os.O_CREATE|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write([]byte("id,amount\n1,100\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	source := NewWebDAV(server.URL, "", "", time.Second).(Archiver)
+	assert.Nil(t, source.Archive("/out/a.csv", "/archive"))
+	assert.Equal(t, "MOVE", methods[len(methods)-1])
+
+	assert.Equal(t, "", readWebDAVFile(t, filesystem, "/out/a.csv"))
+	assert.Equal(t, "id,amount\n1,100\n", readWebDAVFile(t, filesystem, "/archive/a.csv"))
+
+	// Without an archive folder the file is kept
+	methods = methods[:0]
+	assert.Nil(t, source.Archive("/archive/a.csv", ""))
+	assert.Empty(t, methods)
+}
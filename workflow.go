@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// StepData is the data available in target.steps templates, Values contains
+// the values extracted from the responses of previous steps
+type StepData struct {
+	*TemplateData
+	Values map[string]string
+}
+
+// uploadSteps runs target.steps in order, e.g. request a presigned url,
+// send the file to it, then commit the upload
+func (u *Uploader) uploadSteps(cli Interface, filepath string, data *TemplateData) error {
+	stepData := &StepData{
+		TemplateData: data,
+		Values:       make(map[string]string),
+	}
+
+	var resp *http.Response
+	var body []byte
+	for index, step := range u.target.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", index+1)
+		}
+
+		Logf("Running upload step=%s ...\n", name)
+		var errStep error
+		resp, body, errStep = u.runStep(cli, filepath, step, stepData)
+		if errStep != nil {
+			return fmt.Errorf("step %s: %w", name, errStep)
+		}
+	}
+
+	// The status url is taken from the response of the last step
+	if u.target.Poll.Status != "" {
+		return u.poll(resp, body, data)
+	}
+
+	return nil
+}
+
+// runStep sends a step request and extracts values from its response,
+// the response is returned with its body already read
+func (u *Uploader) runStep(cli Interface, filepath string, step Step, stepData *StepData) (*http.Response, []byte, error) {
+	stepURL, err := renderTemplate(step.URL, stepData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetURL, err := url.Parse(u.target.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A relative step url is resolved against target.host
+	requestURL, err := targetURL.Parse(stepURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	method := strings.ToUpper(step.Method)
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequest(method, requestURL.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if u.isTargetHost(requestURL) {
+		err = u.setTargetHeader(req.Header, stepData.TemplateData)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, header := range step.Header {
+		value, errRender := renderTemplate(header["value"], stepData)
+		if errRender != nil {
+			return nil, nil, errRender
+		}
+		req.Header.Set(header["key"], value)
+	}
+
+	var resp *http.Response
+	if step.Mode != "" {
+		filename, errFilename := u.targetFilename(stepData.TemplateData)
+		if errFilename != nil {
+			return nil, nil, errFilename
+		}
+
+		fields, errFields := u.renderUploadFields(stepData.TemplateData)
+		if errFields != nil {
+			return nil, nil, errFields
+		}
+
+		contentType, writeBody := newBodyWriter(step.Mode, step.ContentType, filename, fields)
+		if req.Header.Get("Content-Type") == "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if strings.ToLower(step.Mode) == `raw` && stepData.Size > 0 {
+			req.ContentLength = stepData.Size
+		}
+
+		resp, err = u.doStream(req, cli, filepath, writeBody)
+	} else {
+		body, errBody := renderTemplate(step.Body, stepData)
+		if errBody != nil {
+			return nil, nil, errBody
+		}
+
+		if body != "" {
+			req.Body = ioutil.NopCloser(strings.NewReader(body))
+			req.ContentLength = int64(len(body))
+			if req.Header.Get("Content-Type") == "" {
+				contentType := step.ContentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				req.Header.Set("Content-Type", contentType)
+			}
+		}
+
+		resp, err = u.httpclient.Do(req)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := checkResponse(resp, step.Success)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, body, extractValues(step.Extract, resp.Header, body, stepData.Values)
+}
+
+// extractValues stores the values of step.extract, taken from a response header
+// or from the json response body using a json path
+func extractValues(extract []map[string]string, header http.Header, body []byte, values map[string]string) error {
+	var data interface{}
+	isDecoded := false
+
+	for _, item := range extract {
+		if item["header"] != "" {
+			values[item["key"]] = header.Get(item["header"])
+			continue
+		}
+
+		if !isDecoded {
+			errDecode := json.Unmarshal(body, &data)
+			if errDecode != nil {
+				return fmt.Errorf("failed to decode response body: %s", errDecode.Error())
+			}
+			isDecoded = true
+		}
+
+		value, errPath := JSONPath(data, item["json"])
+		if errPath != nil {
+			return errPath
+		}
+		values[item["key"]] = JSONPathString(value, "$")
+	}
+
+	return nil
+}
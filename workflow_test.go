@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractValues(t *testing.T) {
+	header := http.Header{}
+	header.Set("ETag", `"abc"`)
+	body := []byte(`{"id": 42, "upload": {"url": "https://storage.example.com/a.csv"}}`)
+
+	values := map[string]string{"previous": "kept"}
+	err := extractValues([]map[string]string{
+		{"key": "etag", "header": "ETag"},
+		{"key": "id", "json": "$.id"},
+		{"key": "upload_url", "json": "$.upload.url"},
+	}, header, body, values)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"previous":   "kept",
+		"etag":       `"abc"`,
+		"id":         "42",
+		"upload_url": "https://storage.example.com/a.csv",
+	}, values)
+
+	// A body which is not json is only decoded when a json path is extracted
+	err = extractValues([]map[string]string{{"key": "etag", "header": "ETag"}}, header, []byte("OK"), values)
+	assert.Nil(t, err)
+	err = extractValues([]map[string]string{{"key": "id", "json": "$.id"}}, header, []byte("OK"), values)
+	assert.NotNil(t, err)
+}
+
+func TestUploadSteps(t *testing.T) {
+	requests := make([]string, 0)
+	uploaded := ""
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, fmt.Sprintf("storage %s %s auth=%s", r.Method, r.URL.Path, r.Header.Get("Authorization")))
+		uploaded = string(body)
+		w.Header().Set("ETag", `"abc"`)
+	}))
+	defer storage.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, fmt.Sprintf("api %s %s auth=%s body=%s", r.Method, r.URL.Path, r.Header.Get("Authorization"), body))
+		if r.URL.Path == "/v1/uploads" {
+			fmt.Fprintf(w, `{"id": "42", "upload_url": "%s/bucket/a.csv"}`, storage.URL)
+		}
+	}))
+	defer api.Close()
+
+	fixture := newUploadFixture(t, "a.csv", &Config{
+		Target: Target{
+			Host:   api.URL + "/v1/",
+			Header: []map[string]string{{"key": "Authorization", "value": "Bearer s3cret"}},
+			Steps: []Step{
+				{
+					Name:    "create",
+					URL:     "uploads",
+					Body:    `{"filename": "{{.Filename}}"}`,
+					Extract: []map[string]string{{"key": "id", "json": "$.id"}, {"key": "upload_url", "json": "$.upload_url"}},
+				},
+				{
+					Name:    "upload",
+					Method:  "put",
+					URL:     "{{.Values.upload_url}}",
+					Mode:    "raw",
+					Extract: []map[string]string{{"key": "etag", "header": "ETag"}},
+				},
+				{
+					Name: "commit",
+					URL:  "uploads/{{.Values.id}}/commit",
+					Body: `{"etag": {{printf "%q" .Values.etag}}}`,
+				},
+			},
+		},
+	})
+
+	assert.Nil(t, fixture.Upload(""))
+	assert.Equal(t, []string{
+		`api POST /v1/uploads auth=Bearer s3cret body={"filename": "a.csv"}`,
+		"storage PUT /bucket/a.csv auth=",
+		`api POST /v1/uploads/42/commit auth=Bearer s3cret body={"etag": "\"abc\""}`,
+	}, requests)
+	assert.Equal(t, "id,amount\n1,100\n", uploaded)
+
+	// A failed step stops the upload and is reported with its name
+	storage.Close()
+	requests = requests[:0]
+	err := fixture.Upload("")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "step upload:"))
+	assert.Len(t, requests, 1)
+}
+
+func TestUploadStepsChecksum(t *testing.T) {
+	received := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, fmt.Sprintf("%s checksum=%s body=%s", r.URL.Path, r.Header.Get("X-Checksum"), body))
+	}))
+	defer server.Close()
+
+	fixture := newUploadFixture(t, "a.csv", &Config{Target: Target{
+		Host: server.URL,
+		Steps: []Step{
+			{Name: "metadata", URL: "metadata", Body: `{"sha": "{{.SHA256}}"}`},
+			{Name: "upload", URL: "files/{{.SHA256}}", Mode: "raw", Header: []map[string]string{{"key": "X-Checksum", "value": "{{.SHA256}}"}}},
+		},
+	}})
+
+	// The checksum is computed when only a step refers to it
+	sum := sha256.Sum256([]byte("id,amount\n1,100\n"))
+	checksum := hex.EncodeToString(sum[:])
+
+	assert.Nil(t, fixture.Upload(""))
+	assert.Equal(t, []string{
+		`/metadata checksum= body={"sha": "` + checksum + `"}`,
+		"/files/" + checksum + " checksum=" + checksum + " body=id,amount\n1,100\n",
+	}, received)
+}